@@ -8,7 +8,11 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	sessionContextKey     = contextKey("session")
+	permissionsContextKey = contextKey("permissions")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -22,3 +26,36 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// authSession identifies the sign-in session a request was authenticated with: by its
+// opaque access token, or by the session ID carried in a signed one.
+type authSession struct {
+	token string
+	id    int64
+}
+
+func (app *application) contextSetSession(r *http.Request, session authSession) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, session)
+	return r.WithContext(ctx)
+}
+
+// contextGetSession() returns the request's session, which is the zero value for
+// anonymous requests.
+func (app *application) contextGetSession(r *http.Request) authSession {
+	session, _ := r.Context().Value(sessionContextKey).(authSession)
+	return session
+}
+
+// contextSetPermissions() stores the permissions carried by a signed access token, so
+// that they don't have to be looked up again.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions() returns the permissions stored by contextSetPermissions(),
+// and false if there are none.
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
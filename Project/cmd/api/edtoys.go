@@ -5,17 +5,22 @@ import (
 	"Project/internal/validator" // New import
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
 )
 
 func (app *application) createEdtoysHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title      string       `json:"title"`
-		Year       int32        `json:"year"`
-		TargetAge  string       `json:"target_age"`
-		Genres     []string     `json:"genres"`
-		SkillFocus []string     `json:"skill_focus"`
-		Runtime    data.Runtime `json:"runtime"`
+		Title        string       `json:"title"`
+		Description  string       `json:"description"`
+		Year         int32        `json:"year"`
+		TargetAge    *string      `json:"target_age"`
+		MinAgeMonths *int32       `json:"min_age_months"`
+		MaxAgeMonths *int32       `json:"max_age_months"`
+		Genres       []string     `json:"genres"`
+		SkillFocus   []string     `json:"skill_focus"`
+		Runtime      data.Runtime `json:"runtime"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -23,18 +28,25 @@ func (app *application) createEdtoysHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	edtoys := &data.Edtoys{
-		Title:      input.Title,
-		Year:       input.Year,
-		TargetAge:  input.TargetAge,
-		Genres:     input.Genres,
-		SkillFocus: input.SkillFocus,
-		Runtime:    input.Runtime,
+		Title:       input.Title,
+		Description: input.Description,
+		Year:        input.Year,
+		Genres:      input.Genres,
+		SkillFocus:  input.SkillFocus,
+		Runtime:     input.Runtime,
 	}
 	// Initialize a new Validator.
 	v := validator.New()
+	app.applyAgeRange(v, edtoys, input.TargetAge, input.MinAgeMonths, input.MaxAgeMonths)
+	taxonomy, err := app.models.Taxonomy.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	taxonomy.Canonicalize(edtoys)
 	// Call the ValidateMovie() function and return a response containing the errors if
 	// any of the checks fail.
-	if data.ValidateEdtoys(v, edtoys); !v.Valid() {
+	if data.ValidateEdtoys(v, edtoys, taxonomy); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -58,8 +70,15 @@ func (app *application) showEdtoysHandler(w http.ResponseWriter, r *http.Request
 		http.NotFound(w, r)
 		return
 	}
+	// An optional sparse fieldset (e.g. fields=id,title,media) trims the response.
+	v := validator.New()
+	fields := app.readFields(r.URL.Query(), showEdtoysFieldSafelist, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
-	edToy, err := app.models.EdToys.Get(id)
+	edToy, err := app.models.EdToys.Get(id, fields.columns()...)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -69,7 +88,39 @@ func (app *application) showEdtoysHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"educational_toys": edToy}, nil)
+	if fields.includes("media") {
+		err = app.attachMedia(edToy)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	// Serve the title and description in the best language the client accepts.
+	err = app.models.Translations.Localize(app.negotiateLocales(r), edToy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Language")
+	// The entity tag changes whenever the response would, so a client revalidating a
+	// copy it already holds gets a bodiless 304 Not Modified.
+	etag := edtoysETag(edToy)
+	if app.ifNoneMatch(r, etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, err := fields.project(edToy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+	headers.Set("Content-Language", edToy.Locale)
+	// Advertise the patch formats that PATCH understands (RFC 5789).
+	headers.Set("Accept-Patch", mergePatchContentType+", "+jsonPatchContentType)
+	err = app.writeJSON(w, http.StatusOK, envelope{"educational_toys": body}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -92,49 +143,81 @@ func (app *application) updateEdToysHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	var input struct {
-		Title      *string       `json:"title"`
-		Year       *int32        `json:"year"`
-		TargetAge  *string       `json:"target_age"`
-		Genres     []string      `json:"genres"`
-		SkillFocus []string      `json:"skill_focus"`
-		Runtime    *data.Runtime `json:"runtime"`
-	}
-	// Read the JSON request body data into the input struct.
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	// If the client sent If-Match, it must still hold the current version of the record.
+	// Otherwise someone else has updated it since the client last read it.
+	if !app.ifMatch(r, edtoysVersionTag(edToys)) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
-	// Copy the values from the request body to the appropriate fields of the movie
-	// record.
-	if input.Title != nil {
-		edToys.Title = *input.Title
-	}
-	if input.Year != nil {
-		edToys.Year = *input.Year
-	}
-	if input.TargetAge != nil {
-		edToys.TargetAge = *input.TargetAge
-	}
-	if input.Genres != nil {
-		edToys.Genres = input.Genres // Note that we don't need to dereference a slice.
+	v := validator.New()
+	// Plain JSON bodies only change the fields they mention, so they can't clear a
+	// field. Merge patches and JSON Patches can; see patchEdtoys().
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
 	}
-	if input.SkillFocus != nil {
-		edToys.SkillFocus = input.SkillFocus
+	switch mediaType {
+	case mergePatchContentType, jsonPatchContentType:
+		if !app.patchEdtoys(w, r, mediaType, edToys, v) {
+			return
+		}
+	case "", "application/json":
+		var input struct {
+			Title        *string       `json:"title"`
+			Description  *string       `json:"description"`
+			Year         *int32        `json:"year"`
+			TargetAge    *string       `json:"target_age"`
+			MinAgeMonths *int32        `json:"min_age_months"`
+			MaxAgeMonths *int32        `json:"max_age_months"`
+			Genres       []string      `json:"genres"`
+			SkillFocus   []string      `json:"skill_focus"`
+			Runtime      *data.Runtime `json:"runtime"`
+		}
+		// Read the JSON request body data into the input struct.
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		// Copy the values from the request body to the appropriate fields of the movie
+		// record.
+		if input.Title != nil {
+			edToys.Title = *input.Title
+		}
+		if input.Description != nil {
+			edToys.Description = *input.Description
+		}
+		if input.Year != nil {
+			edToys.Year = *input.Year
+		}
+		if input.Genres != nil {
+			edToys.Genres = input.Genres // Note that we don't need to dereference a slice.
+		}
+		if input.SkillFocus != nil {
+			edToys.SkillFocus = input.SkillFocus
+		}
+		if input.Runtime != nil {
+			edToys.Runtime = *input.Runtime
+		}
+		app.applyAgeRange(v, edToys, input.TargetAge, input.MinAgeMonths, input.MaxAgeMonths)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "application/json", mergePatchContentType, jsonPatchContentType)
+		return
 	}
-	if input.Runtime != nil {
-		edToys.Runtime = *input.Runtime
+	taxonomy, err := app.models.Taxonomy.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
+	taxonomy.Canonicalize(edToys)
 	// Validate the updated movie record, sending the client a 422 Unprocessable Entity
 	// response if any checks fail.
-	v := validator.New()
-	if data.ValidateEdtoys(v, edToys); !v.Valid() {
+	if data.ValidateEdtoys(v, edToys, taxonomy); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 	// Pass the updated movie record to our new Update() method.
-	err = app.models.EdToys.Update(edToys)
+	err = app.models.EdToys.Update(edToys, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -146,7 +229,9 @@ func (app *application) updateEdToysHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Write the updated movie record in a JSON response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"educational_toys": edToys}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", edtoysETag(edToys))
+	err = app.writeJSON(w, http.StatusOK, envelope{"educational_toys": edToys}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -160,42 +245,62 @@ func (app *application) deleteEdToysHandler(w http.ResponseWriter, r *http.Reque
 		app.notFoundResponse(w, r)
 		return
 	}
+	// When the client sent If-Match, check it against the current record and then only
+	// delete that exact version. Without the header the delete is unconditional.
+	var version int32
+	if r.Header.Get("If-Match") != "" {
+		edToy, err := app.models.EdToys.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !app.ifMatch(r, edtoysVersionTag(edToy)) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+		version = edToy.Version
+	}
 	// Delete the movie from the database, sending a 404 Not Found response to the
 	// client if there isn't a matching record.
-	err = app.models.EdToys.Delete(id)
+	err = app.models.EdToys.Delete(id, version)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 	// Return a 200 OK status code along with a success message.
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "educational toy successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "educational toy successfully moved to trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// edtoysSortSafelist holds the sort values accepted by the list and export endpoints.
+var edtoysSortSafelist = []string{"id", "title", "year", "runtime", "relevance", "rating", "-id", "-title", "-year", "-runtime", "-rating"}
+
 func (app *application) listEdToysHandler(w http.ResponseWriter, r *http.Request) {
 	// To keep things consistent with our other handlers, we'll define an input struct
 	// to hold the expected values from the request query string.
 	var input struct {
-		Title  string
-		Genres []string
+		data.EdtoysCriteria
 		data.Filters
 	}
 	// Initialize a new Validator instance.
 	v := validator.New()
 	// Call r.URL.Query() to get the url.Values map containing the query string data.
 	qs := r.URL.Query()
-	// Use our helpers to extract the title and genres query string values, falling back
-	// to defaults of an empty string and an empty slice respectively if they are not
-	// provided by the client.
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.EdtoysCriteria = app.readEdtoysCriteria(qs, v)
 	// Get the page and page_size query string values as integers. Notice that we set
 	// the default page value to 1 and default page_size to 20, and that we pass the
 	// validator instance as the final argument here.
@@ -204,18 +309,140 @@ func (app *application) listEdToysHandler(w http.ResponseWriter, r *http.Request
 	// Extract the sort query string value, falling back to "id" if it is not provided
 	// by the client (which will imply a ascending sort on movie ID).
 	input.Filters.Sort = app.readString(qs, "sort", "id")
+	// An opaque cursor taken from a previous response's metadata switches the listing
+	// over to keyset pagination, in which case the page value is ignored.
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
 	// Check the Validator instance for any errors and use the failedValidationResponse()
 	// helper to send the client a response if necessary.
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = edtoysSortSafelist
+	// Optional facet counts (e.g. facets=genres,year) for building filter sidebars.
+	facetNames := app.readCSV(qs, "facets", []string{})
+	// An optional sparse fieldset; only the requested columns are read and sent.
+	fields := app.readFields(qs, listEdtoysFieldSafelist, v)
+	data.ValidateEdtoysCriteria(v, input.EdtoysCriteria)
+	data.ValidateFacets(v, facetNames)
+	v.Check(input.Filters.Sort != "relevance" || input.Search != "", "sort", "relevance requires a q search term")
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	edToys, metadata, err := app.models.EdToys.GetAll(input.Title, input.Genres, input.Filters)
+	taxonomy, err := app.models.Taxonomy.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	taxonomy.CanonicalizeCriteria(&input.EdtoysCriteria)
+	// The search term is also matched against translations into the client's preferred
+	// locale, and the results come back in the best language available for each.
+	locales := app.negotiateLocales(r)
+	input.SearchLocale = locales[0]
+	edToys, metadata, err := app.models.EdToys.GetAll(input.EdtoysCriteria, input.Filters, fields.columns()...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Translations.Localize(locales, edToys...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if fields.includes("media") {
+		err = app.attachMedia(edToys...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if fields.includes("availability") {
+		err = app.attachAvailability(edToys...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	body, err := fields.projectEdtoys(edToys)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{"educational_toys": body, "metadata": metadata}
+	if len(facetNames) > 0 {
+		facets, err := app.models.EdToys.Facets(input.EdtoysCriteria, facetNames)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["facets"] = facets
+	}
+	headers := make(http.Header)
+	if language := contentLanguage(edToys...); language != "" {
+		headers.Set("Content-Language", language)
+	}
+	w.Header().Add("Vary", "Accept-Language")
 	// Dump the contents of the input struct in a HTTP response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"educational_toys": edToys, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 
 }
+
+// The readEdtoysCriteria() helper reads the catalog filters shared by the list and
+// export endpoints from the query string.
+func (app *application) readEdtoysCriteria(qs url.Values, v *validator.Validator) data.EdtoysCriteria {
+	var criteria data.EdtoysCriteria
+	// Use our helpers to extract the title and genres query string values, falling back
+	// to defaults of an empty string and an empty slice respectively if they are not
+	// provided by the client.
+	criteria.Title = app.readString(qs, "title", "")
+	criteria.Genres = app.readCSV(qs, "genres", []string{})
+	// The q parameter accepts web search syntax ("quoted phrases", OR, -excluded) and
+	// is matched against the title, skill focus, genres and description.
+	criteria.Search = app.readString(qs, "q", "")
+	// Read the optional range and attribute filters. Numeric and date values which fail
+	// to parse are recorded in the validator just like page and page_size.
+	criteria.YearMin = app.readInt(qs, "year_min", 0, v)
+	criteria.YearMax = app.readInt(qs, "year_max", 0, v)
+	criteria.RuntimeMin = app.readInt(qs, "runtime_min", 0, v)
+	criteria.RuntimeMax = app.readInt(qs, "runtime_max", 0, v)
+	criteria.TargetAge = app.readString(qs, "target_age", "")
+	// The age filter finds toys suitable for a child of the given age, which can be given
+	// in whole years or, for babies and toddlers, as age_months.
+	switch {
+	case qs.Get("age_months") != "":
+		months := app.readInt(qs, "age_months", 0, v)
+		criteria.AgeMonths = &months
+	case qs.Get("age") != "":
+		months := app.readInt(qs, "age", 0, v) * 12
+		criteria.AgeMonths = &months
+	}
+	criteria.SkillFocus = app.readCSV(qs, "skill_focus", []string{})
+	criteria.SkillFocusMatch = app.readString(qs, "skill_focus_match", "any")
+	criteria.CreatedAfter = app.readTime(qs, "created_after", v)
+	criteria.CreatedBefore = app.readTime(qs, "created_before", v)
+	return criteria
+}
+
+// The applyAgeRange() helper copies the age fields of a create or update request onto
+// a record. Clients can either send the structured min_age_months/max_age_months pair
+// or, for backwards compatibility, a target_age string such as "3+" or "4-6 years",
+// but not both. Since a missing max_age_months key can't be told apart from a null
+// one, an open-ended range is set by sending a target_age like "3+".
+func (app *application) applyAgeRange(v *validator.Validator, edtoys *data.Edtoys, targetAge *string, min, max *int32) {
+	if targetAge != nil {
+		if min != nil || max != nil {
+			v.AddError("target_age", "must not be combined with min_age_months or max_age_months")
+			return
+		}
+		if err := edtoys.SetTargetAge(*targetAge); err != nil {
+			v.AddError("target_age", "must be in a format like 3+, 4-6 years or 18-36 months")
+		}
+		return
+	}
+	if min != nil {
+		edtoys.MinAgeMonths = *min
+	}
+	if max != nil {
+		edtoys.MaxAgeMonths = max
+	}
+}
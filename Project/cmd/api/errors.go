@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // The logError() method is a generic helper for logging an error message. Later in the
@@ -67,6 +68,13 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	message := "unable to update the record due to an edit conflict, please try again"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
+func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, message string) {
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since it was last fetched, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
@@ -83,6 +91,11 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired refresh token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -92,7 +105,27 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
 
+func (app *application) mfaEnrollmentRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must set up two-factor authentication on your account to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) invalidMFATokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired mfa token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidMFACodeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid two-factor authentication code"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	message := fmt.Sprintf("the request body must be one of: %s", strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exports are allowed to run well past the server's usual write timeout.
+const exportTimeout = 10 * time.Minute
+
+// edtoysExporter writes records out in one of the supported export formats. begin() is
+// called before the first record and end() after the last one.
+type edtoysExporter interface {
+	begin() error
+	write(edtoys *data.Edtoys) error
+	end() error
+}
+
+func (app *application) exportEdtoysHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	criteria := app.readEdtoysCriteria(qs, v)
+	format := app.readString(qs, "format", "ndjson")
+	// Only the sort matters here: there is no page or page_size, since the export
+	// always covers every matching record.
+	filters := data.Filters{
+		Sort:         app.readString(qs, "sort", "id"),
+		SortSafelist: edtoysSortSafelist,
+	}
+	data.ValidateEdtoysCriteria(v, criteria)
+	v.Check(validator.In(format, "csv", "ndjson", "json"), "format", "must be one of csv, ndjson or json")
+	v.Check(validator.In(filters.Sort, filters.SortSafelist...), "sort", "invalid sort value")
+	v.Check(filters.Sort != "relevance" || criteria.Search != "", "sort", "relevance requires a q search term")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	taxonomy, err := app.models.Taxonomy.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	taxonomy.CanonicalizeCriteria(&criteria)
+
+	var exporter edtoysExporter
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		exporter = &csvExporter{w: csv.NewWriter(w)}
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		exporter = &jsonExporter{w: w, enc: json.NewEncoder(w)}
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		exporter = &jsonExporter{w: w, enc: json.NewEncoder(w), array: true}
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="edtoys.`+format+`"`)
+
+	// Lift the server-wide write deadline for this response only.
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Now().Add(exportTimeout))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), exportTimeout)
+	defer cancel()
+
+	// Nothing is written until the first row arrives, so a query that fails outright
+	// can still be reported with a proper error response.
+	started := false
+	err = app.models.EdToys.Export(ctx, criteria, filters, func(edtoys *data.Edtoys) error {
+		if !started {
+			started = true
+			if err := exporter.begin(); err != nil {
+				return err
+			}
+		}
+		return exporter.write(edtoys)
+	})
+	if err == nil && !started {
+		started = true
+		err = exporter.begin()
+	}
+	if err == nil {
+		err = exporter.end()
+	}
+	if err != nil {
+		if !started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// The status line has already gone out, so all we can do is log the failure
+		// and cut the response short.
+		app.logError(r, err)
+	}
+}
+
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvExporter) begin() error {
+	return e.w.Write([]string{"id", "title", "description", "year", "target_age", "min_age_months", "max_age_months", "genres", "skill_focus", "runtime", "version"})
+}
+
+// The list columns use the same "|" separator that the CSV import expects, so an export
+// can be loaded straight back in.
+func (e *csvExporter) write(edtoys *data.Edtoys) error {
+	maxAge := ""
+	if edtoys.MaxAgeMonths != nil {
+		maxAge = strconv.FormatInt(int64(*edtoys.MaxAgeMonths), 10)
+	}
+	return e.w.Write([]string{
+		strconv.FormatInt(edtoys.ID, 10),
+		edtoys.Title,
+		edtoys.Description,
+		strconv.FormatInt(int64(edtoys.Year), 10),
+		edtoys.TargetAge,
+		strconv.FormatInt(int64(edtoys.MinAgeMonths), 10),
+		maxAge,
+		strings.Join(edtoys.Genres, "|"),
+		strings.Join(edtoys.SkillFocus, "|"),
+		strconv.FormatInt(int64(edtoys.Runtime), 10),
+		strconv.FormatInt(int64(edtoys.Version), 10),
+	})
+}
+
+func (e *csvExporter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonExporter writes one JSON object per line. With array set the objects are wrapped
+// in a single JSON array instead, which is written incrementally rather than being
+// marshaled in one go like writeJSON() does.
+type jsonExporter struct {
+	w     io.Writer
+	enc   *json.Encoder
+	array bool
+	count int
+}
+
+func (e *jsonExporter) begin() error {
+	if e.array {
+		_, err := io.WriteString(e.w, "[\n")
+		return err
+	}
+	return nil
+}
+
+func (e *jsonExporter) write(edtoys *data.Edtoys) error {
+	if e.array && e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	return e.enc.Encode(edtoys)
+}
+
+func (e *jsonExporter) end() error {
+	if e.array {
+		_, err := io.WriteString(e.w, "]\n")
+		return err
+	}
+	return nil
+}
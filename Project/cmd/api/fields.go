@@ -0,0 +1,97 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"encoding/json"
+	"net/url"
+)
+
+// The fields accepted by ?fields= on the show and list endpoints. On top of the stored
+// columns, clients can ask for the related media to be embedded, and the list can
+// also include availability and the search rank and headline.
+var (
+	showEdtoysFieldSafelist = append(data.EdtoysColumnFields(), "media")
+	listEdtoysFieldSafelist = append(data.EdtoysColumnFields(), "media", "availability", "rank", "headline")
+)
+
+// A fieldset is the sparse set of fields a client asked for. An empty fieldset means
+// the full representation.
+type fieldset []string
+
+// The readFields() helper reads a comma-separated fieldset from the query string and
+// validates it against the safelist.
+func (app *application) readFields(qs url.Values, safelist []string, v *validator.Validator) fieldset {
+	fields := app.readCSV(qs, "fields", []string{})
+	for _, field := range fields {
+		if !validator.In(field, safelist...) {
+			v.AddError("fields", "contains an unknown field: "+field)
+			break
+		}
+	}
+	v.Check(validator.Unique(fields), "fields", "must not contain duplicate values")
+	return fieldset(fields)
+}
+
+// includes() reports whether the named field should be part of the response.
+func (f fieldset) includes(name string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	return validator.In(name, f...)
+}
+
+// columns() returns the fields to read from the database. A fieldset made up only of
+// relations still reads the id, which also keeps it from meaning "everything".
+func (f fieldset) columns() []string {
+	if len(f) == 0 {
+		return nil
+	}
+	columns := []string{"id"}
+	for _, field := range f {
+		if validator.In(field, data.EdtoysColumnFields()...) {
+			columns = append(columns, field)
+		}
+	}
+	return columns
+}
+
+// project() trims the JSON representation of a record down to the fieldset. The record
+// is returned unchanged if the fieldset is empty.
+func (f fieldset) project(record interface{}) (interface{}, error) {
+	if len(f) == 0 {
+		return record, nil
+	}
+	js, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(js, &all)
+	if err != nil {
+		return nil, err
+	}
+	projected := make(map[string]json.RawMessage, len(f))
+	for _, field := range f {
+		if value, ok := all[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected, nil
+}
+
+// projectEdtoys() applies project() to each record of a listing.
+func (f fieldset) projectEdtoys(edToys []*data.Edtoys) (interface{}, error) {
+	if len(f) == 0 {
+		return edToys, nil
+	}
+	projected := make([]interface{}, len(edToys))
+	for i, edToy := range edToys {
+		var err error
+		projected[i], err = f.project(edToy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return projected, nil
+}
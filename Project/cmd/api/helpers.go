@@ -1,16 +1,21 @@
 package main
 
 import (
+	"Project/internal/data"
 	"Project/internal/validator"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"hash/fnv"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
@@ -22,6 +27,82 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// The readIntParam() helper reads a positive integer URL parameter other than the
+// record ID, such as a version number.
+func (app *application) readIntParam(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	i, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || i < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	return i, nil
+}
+
+// edtoysETag() returns the entity tag for a record as served. It starts with the tag
+// from edtoysVersionTag(), followed by a hash of what the response carries that can
+// change without the version changing: the rating summary, which reviews keep up to
+// date, the media attached to it, and the locale a translation was served in.
+func edtoysETag(edtoys *data.Edtoys) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d %g", edtoys.ReviewCount, edtoys.AverageRating)
+	// Media files are never changed once uploaded, only added or deleted, so their IDs
+	// are enough to tell whether the list has changed.
+	for _, media := range edtoys.Media {
+		fmt.Fprintf(h, " m%d", media.ID)
+	}
+	if edtoys.Locale != "" && edtoys.Locale != data.DefaultLocale {
+		fmt.Fprintf(h, " %s", edtoys.Locale)
+	}
+	return fmt.Sprintf(`"%d-%d-%08x"`, edtoys.ID, edtoys.Version, h.Sum32())
+}
+
+// edtoysVersionTag() returns the entity tag that identifies a version of a record
+// whatever representation it was served in, which is what writes are checked against.
+func edtoysVersionTag(edtoys *data.Edtoys) string {
+	return fmt.Sprintf(`"%d-%d"`, edtoys.ID, edtoys.Version)
+}
+
+// The ifMatch() helper reports whether the request's If-Match header, if any, allows a
+// write to go ahead against a resource with the given entity tag. A missing header
+// always allows it. Per RFC 9110 If-Match uses strong comparison, so weak tags never
+// match. Tags for other representations of the same version, which extend the given tag
+// with a "-" suffix (as edtoysETag() does), match as well, so a client can send back
+// whichever tag it was served.
+func (app *application) ifMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	prefix := strings.TrimSuffix(etag, `"`) + "-"
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+		if strings.HasPrefix(candidate, prefix) && strings.HasSuffix(candidate, `"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// The ifNoneMatch() helper reports whether the request's If-None-Match header matches
+// the given entity tag, meaning the client's cached copy is still current. It uses weak
+// comparison, so a W/ prefix on either side is ignored.
+func (app *application) ifNoneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
 type envelope map[string]interface{}
 
 // Change the data parameter to have the type envelope instead of interface{}.
@@ -149,6 +230,52 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// The readTime() helper reads an RFC 3339 timestamp from the query string. It returns
+// nil if no matching key could be found, and records an error in the provided Validator
+// instance if the value couldn't be parsed.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp")
+		return nil
+	}
+	return &t
+}
+
+// The readFloat() helper reads a floating-point value from the query string, returning
+// the default value if the key is missing and recording an error if it can't be parsed.
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+	return f
+}
+
+// The readBool() helper reads a boolean value from the query string, accepting the
+// forms understood by strconv.ParseBool().
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
 func (app *application) background(fn func()) {
 	// Increment the WaitGroup counter.
 	app.wg.Add(1)
@@ -164,3 +291,42 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// clientIP() returns the IP address of the client that made the request, without the
+// port.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// clientUserAgent() returns the request's User-Agent header, cut short if it's
+// unreasonably long so that it can be stored alongside a session.
+func clientUserAgent(r *http.Request) string {
+	userAgent := r.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = strings.ToValidUTF8(userAgent[:512], "")
+	}
+	return userAgent
+}
+
+// The userPermissions() helper returns the permissions of the authenticated user. They
+// come from the access token when it's a signed one, and from the database otherwise.
+func (app *application) userPermissions(r *http.Request) (data.Permissions, error) {
+	if permissions, ok := app.contextGetPermissions(r); ok {
+		return permissions, nil
+	}
+	return app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+}
+
+// The currentSessionID() helper returns the ID of the session the request was
+// authenticated with, or zero for an anonymous request.
+func (app *application) currentSessionID(r *http.Request) (int64, error) {
+	session := app.contextGetSession(r)
+	if session.id != 0 || session.token == "" {
+		return session.id, nil
+	}
+	return app.models.Tokens.SessionIDForToken(session.token)
+}
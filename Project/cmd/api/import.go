@@ -0,0 +1,291 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Imports are allowed a much larger body than the 1MB readJSON() limit, since supplier
+// spreadsheets routinely run to thousands of rows.
+const maxImportBytes = 10 << 20
+
+// importRow pairs a parsed record with the line of the upload it came from, so that
+// errors can be reported back against the client's own file.
+type importRow struct {
+	line   int
+	edtoys *data.Edtoys
+}
+
+func (app *application) importEdtoysHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	mode := app.readString(r.URL.Query(), "mode", "atomic")
+	v.Check(validator.In(mode, "atomic", "best_effort"), "mode", "must be either atomic or best_effort")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var rows []importRow
+	rowErrors := make(map[string]map[string]string)
+	switch mediaType {
+	case "text/csv":
+		rows, err = app.readImportCSV(r.Body, rowErrors)
+	case "application/x-ndjson", "application/ndjson":
+		rows, err = app.readImportNDJSON(r.Body, rowErrors)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "text/csv", "application/x-ndjson")
+		return
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("body must not be larger than %d bytes", maxImportBytes)
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if len(rows) == 0 && len(rowErrors) == 0 {
+		app.badRequestResponse(w, r, errors.New("body must contain at least one row"))
+		return
+	}
+
+	// Run every parsed row through the same checks as createEdtoysHandler.
+	taxonomy, err := app.models.Taxonomy.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	var valid []importRow
+	for _, row := range rows {
+		v := validator.New()
+		taxonomy.Canonicalize(row.edtoys)
+		if data.ValidateEdtoys(v, row.edtoys, taxonomy); !v.Valid() {
+			rowErrors[strconv.Itoa(row.line)] = v.Errors
+			continue
+		}
+		valid = append(valid, row)
+	}
+
+	// In atomic mode a single bad row rejects the whole upload before we touch the
+	// database.
+	if mode == "atomic" && len(rowErrors) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, envelope{"rows": rowErrors})
+		return
+	}
+
+	edtoys := make([]*data.Edtoys, len(valid))
+	for i := range valid {
+		edtoys[i] = valid[i].edtoys
+	}
+	failed, err := app.models.EdToys.InsertMany(edtoys, mode == "best_effort")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for i, err := range failed {
+		rowErrors[strconv.Itoa(valid[i].line)] = map[string]string{"row": err.Error()}
+	}
+	// A row the database rejected has rolled back the whole upload in atomic mode.
+	if mode == "atomic" && len(rowErrors) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, envelope{"rows": rowErrors})
+		return
+	}
+
+	result := envelope{
+		"inserted": len(valid) - len(failed),
+		"failed":   len(rowErrors),
+		"errors":   rowErrors,
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"import": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readImportCSV() parses a CSV upload. The first line must be a header naming the
+// columns; genres and skill_focus hold multiple values separated by "|", and runtime may
+// be given either as a plain number of minutes or as "<n> mins". The age range comes
+// from min_age_months/max_age_months when those columns are filled in, and from a
+// legacy target_age string otherwise. The description column is optional. Rows which
+// can't be parsed are recorded in rowErrors rather than failing the whole upload.
+func (app *application) readImportCSV(body io.Reader, rowErrors map[string]map[string]string) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"title", "year", "genres", "skill_focus", "runtime"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv header is missing the %q column", name)
+		}
+	}
+	_, hasTargetAge := columns["target_age"]
+	_, hasMinAge := columns["min_age_months"]
+	if !hasTargetAge && !hasMinAge {
+		return nil, errors.New(`csv header must contain either the "target_age" or the "min_age_months" column`)
+	}
+	// Allow the data rows to differ in length from the header; missing trailing values
+	// are then reported by the row validation below.
+	reader.FieldsPerRecord = -1
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			rowErrors[strconv.Itoa(parseError.Line)] = map[string]string{"row": parseError.Err.Error()}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		list := func(name string) []string {
+			var values []string
+			for _, value := range strings.Split(field(name), "|") {
+				if value = strings.TrimSpace(value); value != "" {
+					values = append(values, value)
+				}
+			}
+			return values
+		}
+
+		errs := make(map[string]string)
+		edtoys := &data.Edtoys{
+			Title:       field("title"),
+			Description: field("description"),
+			Genres:      list("genres"),
+			SkillFocus:  list("skill_focus"),
+		}
+		if s := field("year"); s != "" {
+			year, err := strconv.ParseInt(s, 10, 32)
+			if err != nil {
+				errs["year"] = "must be an integer value"
+			}
+			edtoys.Year = int32(year)
+		}
+		if s := strings.TrimSuffix(field("runtime"), " mins"); s != "" {
+			runtime, err := strconv.ParseInt(s, 10, 32)
+			if err != nil {
+				errs["runtime"] = "must be an integer number of minutes"
+			}
+			edtoys.Runtime = data.Runtime(runtime)
+		}
+		if s := field("min_age_months"); s != "" {
+			min, err := strconv.ParseInt(s, 10, 32)
+			if err != nil {
+				errs["min_age_months"] = "must be an integer value"
+			}
+			edtoys.MinAgeMonths = int32(min)
+			if s := field("max_age_months"); s != "" {
+				max, err := strconv.ParseInt(s, 10, 32)
+				if err != nil {
+					errs["max_age_months"] = "must be an integer value"
+				}
+				maxAge := int32(max)
+				edtoys.MaxAgeMonths = &maxAge
+			}
+		} else if s := field("target_age"); s != "" {
+			if err := edtoys.SetTargetAge(s); err != nil {
+				errs["target_age"] = "must be in a format like 3+, 4-6 years or 18-36 months"
+			}
+		}
+		if len(errs) > 0 {
+			rowErrors[strconv.Itoa(line)] = errs
+			continue
+		}
+		rows = append(rows, importRow{line: line, edtoys: edtoys})
+	}
+	return rows, nil
+}
+
+// readImportNDJSON() parses a newline-delimited JSON upload, where each non-blank line
+// holds one object in the same shape as the createEdtoysHandler request body.
+func (app *application) readImportNDJSON(body io.Reader, rowErrors map[string]map[string]string) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var input struct {
+			Title        string       `json:"title"`
+			Description  string       `json:"description"`
+			Year         int32        `json:"year"`
+			TargetAge    *string      `json:"target_age"`
+			MinAgeMonths *int32       `json:"min_age_months"`
+			MaxAgeMonths *int32       `json:"max_age_months"`
+			Genres       []string     `json:"genres"`
+			SkillFocus   []string     `json:"skill_focus"`
+			Runtime      data.Runtime `json:"runtime"`
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&input); err != nil {
+			rowErrors[strconv.Itoa(line)] = map[string]string{"row": err.Error()}
+			continue
+		}
+		if dec.More() {
+			rowErrors[strconv.Itoa(line)] = map[string]string{"row": "line must only contain a single JSON value"}
+			continue
+		}
+		edtoys := &data.Edtoys{
+			Title:       input.Title,
+			Description: input.Description,
+			Year:        input.Year,
+			Genres:      input.Genres,
+			SkillFocus:  input.SkillFocus,
+			Runtime:     input.Runtime,
+		}
+		v := validator.New()
+		if app.applyAgeRange(v, edtoys, input.TargetAge, input.MinAgeMonths, input.MaxAgeMonths); !v.Valid() {
+			rowErrors[strconv.Itoa(line)] = v.Errors
+			continue
+		}
+		rows = append(rows, importRow{line: line, edtoys: edtoys})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/jsonlog"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestReadImportCSV(t *testing.T) {
+	months := func(n int32) *int32 { return &n }
+	body := "Title, YEAR ,genres,Skill_Focus,runtime,target_age,min_age_months,max_age_months,description\n" +
+		"Shape Sorter,2019,puzzles | logic,fine-motor,15 mins,3+,,,Wooden shapes\n" +
+		"\"Stacking\nRings\",2018,puzzles,,20,18-36 months,,,\n" +
+		"Counting Bears,2020,math|,counting,30,3+,6,24,\n"
+	rowErrors := make(map[string]map[string]string)
+	rows, err := (&application{}).readImportCSV(strings.NewReader(body), rowErrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowErrors) != 0 {
+		t.Errorf("rowErrors = %v, want none", rowErrors)
+	}
+	want := []importRow{
+		{line: 2, edtoys: &data.Edtoys{
+			Title:        "Shape Sorter",
+			Description:  "Wooden shapes",
+			Year:         2019,
+			MinAgeMonths: 36,
+			Genres:       []string{"puzzles", "logic"},
+			SkillFocus:   []string{"fine-motor"},
+			Runtime:      15,
+		}},
+		// A quoted value may run over several lines; the row is reported at the line it
+		// starts on, and later rows keep their own line numbers.
+		{line: 3, edtoys: &data.Edtoys{
+			Title:        "Stacking\nRings",
+			Year:         2018,
+			MinAgeMonths: 18,
+			MaxAgeMonths: months(36),
+			Genres:       []string{"puzzles"},
+			Runtime:      20,
+		}},
+		// min_age_months and max_age_months take precedence over target_age.
+		{line: 5, edtoys: &data.Edtoys{
+			Title:        "Counting Bears",
+			Year:         2020,
+			MinAgeMonths: 6,
+			MaxAgeMonths: months(24),
+			Genres:       []string{"math"},
+			SkillFocus:   []string{"counting"},
+			Runtime:      30,
+		}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		for _, row := range rows {
+			t.Logf("got line %d: %+v", row.line, *row.edtoys)
+		}
+		t.Errorf("readImportCSV returned %d rows, want %d as above", len(rows), len(want))
+	}
+}
+
+func TestReadImportCSVHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"empty body", "", "body must not be empty"},
+		{"missing column", "title,year,genres,runtime,target_age\n", `csv header is missing the "skill_focus" column`},
+		{"no age column", "title,year,genres,skill_focus,runtime\n", `csv header must contain either the "target_age" or the "min_age_months" column`},
+		{"header only", "runtime,skill_focus,genres,year,title,min_age_months\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&application{}).readImportCSV(strings.NewReader(tt.body), make(map[string]map[string]string))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("readImportCSV error = %v, want none", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("readImportCSV error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadImportCSVMalformedRows(t *testing.T) {
+	body := "title,year,genres,skill_focus,runtime,target_age,min_age_months,max_age_months\n" +
+		"Bad Year,19x9,puzzles,logic,15,3+,,\n" +
+		"Bad Runtime,2019,puzzles,logic,ten mins,3+,,\n" +
+		"Bad \"Quote\",2019,puzzles,logic,15,3+,,\n" +
+		"Good,2019,puzzles,logic,15,3+,,\n" +
+		"Bad Age,2019,puzzles,logic,15,toddlers,,\n" +
+		"Bad Range,2019,puzzles,logic,15,,six,many\n" +
+		"Short Row,2019\n"
+	rowErrors := make(map[string]map[string]string)
+	rows, err := (&application{}).readImportCSV(strings.NewReader(body), rowErrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].line != 5 || rows[1].line != 8 {
+		t.Errorf("readImportCSV returned rows %v, want lines 5 and 8", rows)
+	}
+	wantFields := map[string][]string{
+		"2": {"year"},
+		"3": {"runtime"},
+		"4": {"row"},
+		"6": {"target_age"},
+		"7": {"min_age_months", "max_age_months"},
+	}
+	if len(rowErrors) != len(wantFields) {
+		t.Errorf("rowErrors = %v, want errors for lines 2, 3, 4, 6 and 7", rowErrors)
+	}
+	for line, fields := range wantFields {
+		for _, field := range fields {
+			if rowErrors[line][field] == "" {
+				t.Errorf("rowErrors[%q] = %v, want an error for %s", line, rowErrors[line], field)
+			}
+		}
+	}
+}
+
+func TestReadImportNDJSON(t *testing.T) {
+	body := `{"title":"Shape Sorter","year":2019,"target_age":"3+","genres":["puzzles"],"skill_focus":["logic"],"runtime":"15 mins"}` + "\n" +
+		"\n" +
+		`{"title":"Shape Sorter","colour":"red"}` + "\n" +
+		`{"title":"a"} {"title":"b"}` + "\n" +
+		"not json\n" +
+		`{"title":"Counting Bears","description":"Bears","year":2020,"min_age_months":18,"max_age_months":36,"genres":["math"],"skill_focus":[],"runtime":"30 mins"}` + "\n" +
+		`{"title":"Both","target_age":"3+","min_age_months":36}` + "\n"
+	rowErrors := make(map[string]map[string]string)
+	rows, err := (&application{}).readImportNDJSON(strings.NewReader(body), rowErrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxAge := int32(36)
+	want := []importRow{
+		{line: 1, edtoys: &data.Edtoys{
+			Title:        "Shape Sorter",
+			Year:         2019,
+			MinAgeMonths: 36,
+			Genres:       []string{"puzzles"},
+			SkillFocus:   []string{"logic"},
+			Runtime:      15,
+		}},
+		{line: 6, edtoys: &data.Edtoys{
+			Title:        "Counting Bears",
+			Description:  "Bears",
+			Year:         2020,
+			MinAgeMonths: 18,
+			MaxAgeMonths: &maxAge,
+			Genres:       []string{"math"},
+			SkillFocus:   []string{},
+			Runtime:      30,
+		}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		for _, row := range rows {
+			t.Logf("got line %d: %+v", row.line, *row.edtoys)
+		}
+		t.Errorf("readImportNDJSON returned %d rows, want %d as above", len(rows), len(want))
+	}
+	wantFields := map[string]string{"3": "row", "4": "row", "5": "row", "7": "target_age"}
+	if len(rowErrors) != len(wantFields) {
+		t.Errorf("rowErrors = %v, want errors for lines 3, 4, 5 and 7", rowErrors)
+	}
+	for line, field := range wantFields {
+		if rowErrors[line][field] == "" {
+			t.Errorf("rowErrors[%q] = %v, want an error for %s", line, rowErrors[line], field)
+		}
+	}
+}
+
+func TestImportEdtoysHandler(t *testing.T) {
+	const header = "title,year,genres,skill_focus,runtime,target_age\n"
+	const good = "Shape Sorter,2019,puzzles,logic,15,3+\n"
+	tests := []struct {
+		name        string
+		mode        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantErrors  map[string]string
+		wantStored  []string
+	}{
+		{
+			name:        "atomic with a bad row",
+			mode:        "atomic",
+			contentType: "text/csv",
+			body:        header + good + "Bad Year,19x9,puzzles,logic,15,3+\n",
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantErrors:  map[string]string{"3": "year"},
+		},
+		{
+			name:        "best effort with a bad row",
+			mode:        "best_effort",
+			contentType: "text/csv",
+			body:        header + good + "Bad Year,19x9,puzzles,logic,15,3+\n",
+			wantStatus:  http.StatusCreated,
+			wantErrors:  map[string]string{"3": "year"},
+			wantStored:  []string{"Shape Sorter"},
+		},
+		{
+			name:        "atomic with a row the database rejects",
+			mode:        "atomic",
+			contentType: "text/csv",
+			body:        header + good + "Rejected,2019,puzzles,logic,15,3+\n",
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantErrors:  map[string]string{"3": "row"},
+		},
+		{
+			name:        "best effort with a row the database rejects",
+			mode:        "best_effort",
+			contentType: "text/csv",
+			body:        header + "Rejected,2019,puzzles,logic,15,3+\n" + good,
+			wantStatus:  http.StatusCreated,
+			wantErrors:  map[string]string{"2": "row"},
+			wantStored:  []string{"Shape Sorter"},
+		},
+		{
+			name:        "unknown genre",
+			mode:        "best_effort",
+			contentType: "application/x-ndjson",
+			body:        `{"title":"Blocks","year":2019,"target_age":"3+","genres":["blocks"],"skill_focus":[],"runtime":"15 mins"}` + "\n",
+			wantStatus:  http.StatusCreated,
+			wantErrors:  map[string]string{"1": "genres"},
+		},
+		{
+			name:        "all good",
+			mode:        "atomic",
+			contentType: "text/csv; charset=utf-8",
+			body:        header + good + "Counting Bears,2020,math,,30,3+\n",
+			wantStatus:  http.StatusCreated,
+			wantErrors:  map[string]string{},
+			wantStored:  []string{"Shape Sorter", "Counting Bears"},
+		},
+		{
+			name:        "unknown mode",
+			mode:        "partial",
+			contentType: "text/csv",
+			body:        header + good,
+			wantStatus:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "unsupported content type",
+			mode:        "atomic",
+			contentType: "application/json",
+			body:        `[]`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &stubStore{reject: "Rejected"}
+			app := &application{
+				logger: jsonlog.New(io.Discard, jsonlog.LevelOff),
+				models: data.NewModels(sql.OpenDB(store)),
+			}
+			r := httptest.NewRequest(http.MethodPost, "/v1/edtoys/import?mode="+tt.mode, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			app.importEdtoysHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if !reflect.DeepEqual(store.stored, tt.wantStored) {
+				t.Errorf("stored %q, want %q", store.stored, tt.wantStored)
+			}
+			if tt.wantErrors == nil {
+				return
+			}
+			// Atomic imports report row errors in a 422; best effort imports report them
+			// alongside the count of inserted rows.
+			var body struct {
+				Error struct {
+					Rows map[string]map[string]string `json:"rows"`
+				} `json:"error"`
+				Import struct {
+					Inserted int                          `json:"inserted"`
+					Failed   int                          `json:"failed"`
+					Errors   map[string]map[string]string `json:"errors"`
+				} `json:"import"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			rowErrors := body.Error.Rows
+			if w.Code == http.StatusCreated {
+				rowErrors = body.Import.Errors
+				if body.Import.Inserted != len(tt.wantStored) || body.Import.Failed != len(tt.wantErrors) {
+					t.Errorf("inserted %d and failed %d, want %d and %d",
+						body.Import.Inserted, body.Import.Failed, len(tt.wantStored), len(tt.wantErrors))
+				}
+			}
+			if len(rowErrors) != len(tt.wantErrors) {
+				t.Errorf("row errors = %v, want errors for %v", rowErrors, tt.wantErrors)
+			}
+			for line, field := range tt.wantErrors {
+				if rowErrors[line][field] == "" {
+					t.Errorf("row errors[%q] = %v, want an error for %s", line, rowErrors[line], field)
+				}
+			}
+		})
+	}
+}
+
+// stubStore is a database/sql driver standing in for Postgres, with just enough
+// behaviour for the import handler: it serves a fixed taxonomy, accepts every insert
+// except those whose title is reject, which fail as a constraint violation would, and
+// keeps the titles of the inserts that were committed.
+type stubStore struct {
+	reject string
+	stored []string
+}
+
+func (s *stubStore) Connect(context.Context) (driver.Conn, error) { return &stubConn{store: s}, nil }
+func (s *stubStore) Driver() driver.Driver                        { return s }
+func (s *stubStore) Open(string) (driver.Conn, error)             { return &stubConn{store: s}, nil }
+
+type stubConn struct {
+	store   *stubStore
+	pending []string
+}
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	return &stubStmt{conn: c, query: query}, nil
+}
+func (c *stubConn) Close() error              { return nil }
+func (c *stubConn) Begin() (driver.Tx, error) { c.pending = nil; return c, nil }
+func (c *stubConn) Commit() error {
+	c.store.stored = append(c.store.stored, c.pending...)
+	return nil
+}
+func (c *stubConn) Rollback() error { c.pending = nil; return nil }
+
+type stubStmt struct {
+	conn  *stubConn
+	query string
+}
+
+func (s *stubStmt) Close() error  { return nil }
+func (s *stubStmt) NumInput() int { return -1 }
+
+func (s *stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	// Savepoints are accepted but not modelled: a rejected row is never added to the
+	// pending inserts in the first place.
+	return driver.RowsAffected(0), nil
+}
+
+func (s *stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.Contains(s.query, "FROM taxonomy_terms"):
+		return &stubRows{
+			columns: []string{"kind", "slug", "name", "synonyms"},
+			values: [][]driver.Value{
+				{"genre", "puzzles", "Puzzles", []byte("{}")},
+				{"genre", "math", "Math", []byte("{}")},
+				{"skill", "logic", "Logic", []byte("{}")},
+				{"skill", "counting", "Counting", []byte("{}")},
+			},
+		}, nil
+	case strings.Contains(s.query, "INSERT INTO edToys"):
+		title := args[0].(string)
+		if title == s.conn.store.reject {
+			return nil, &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}
+		}
+		s.conn.pending = append(s.conn.pending, title)
+		// Answer whichever columns the statement returns.
+		returning := strings.Split(s.query[strings.Index(s.query, "RETURNING")+len("RETURNING"):], ",")
+		row := make([]driver.Value, len(returning))
+		for i, column := range returning {
+			switch strings.TrimSpace(column) {
+			case "created_at":
+				row[i] = time.Now()
+			case "target_age":
+				row[i] = "3+"
+			default:
+				row[i] = int64(len(s.conn.pending))
+			}
+		}
+		return &stubRows{columns: returning, values: [][]driver.Value{row}}, nil
+	}
+	return &stubRows{}, nil
+}
+
+type stubRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+func (r *stubRows) Close() error      { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
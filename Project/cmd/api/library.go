@@ -0,0 +1,303 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"errors"
+	"net/http"
+)
+
+func (app *application) listCopiesHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	copies, err := app.models.Copies.GetAllForEdtoy(edToy.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"copies": copies}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createCopyHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Barcode string `json:"barcode"`
+		Notes   string `json:"notes"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	c := &data.Copy{
+		EdtoyID: edToy.ID,
+		Barcode: input.Barcode,
+		Notes:   input.Notes,
+	}
+	v := validator.New()
+	if data.ValidateCopy(v, c); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Copies.Insert(c)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateBarcode):
+			v.AddError("barcode", "a copy with this barcode already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"copy": c}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) retireCopyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	copyID, err := app.readIntParam(r, "copyID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Copies.Retire(id, copyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrCopyOnLoan):
+			app.conflictResponse(w, r, "the copy is on loan and can't be retired until it is returned")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "copy successfully retired"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) checkoutEdtoysHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	loan, err := app.models.Loans.Checkout(id, app.contextGetUser(r).ID, app.config.library.loanPeriod)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrAlreadyBorrowed):
+			app.conflictResponse(w, r, "you already have a copy of this educational toy on loan")
+		case errors.Is(err, data.ErrNoCopyAvailable):
+			app.conflictResponse(w, r, "no copy is available to you right now, please reserve one instead")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The returnLoanHandler() checks a copy back in. Borrowers can return their own loans,
+// and anyone with the edtoys:write permission can return any loan at the desk.
+func (app *application) returnLoanHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	loan, err := app.models.Loans.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user := app.contextGetUser(r)
+	if loan.UserID != user.ID {
+		permissions, err := app.userPermissions(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.Include("edtoys:write") {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+	err = app.models.Loans.Return(loan)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.conflictResponse(w, r, "the loan has already been returned")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"loan": loan}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listLoansHandler() lets library staff look through every loan, for example with
+// overdue=true to chase up late returns.
+func (app *application) listLoansHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	criteria := data.LoanCriteria{
+		UserID: int64(app.readInt(qs, "user_id", 0, v)),
+	}
+	app.listLoans(w, r, criteria, v)
+}
+
+func (app *application) listUserLoansHandler(w http.ResponseWriter, r *http.Request) {
+	criteria := data.LoanCriteria{UserID: app.contextGetUser(r).ID}
+	app.listLoans(w, r, criteria, validator.New())
+}
+
+func (app *application) listLoans(w http.ResponseWriter, r *http.Request, criteria data.LoanCriteria, v *validator.Validator) {
+	var input struct {
+		data.Filters
+	}
+	qs := r.URL.Query()
+	criteria.Active = app.readBool(qs, "active", false, v)
+	criteria.Overdue = app.readBool(qs, "overdue", false, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-checked_out_at")
+	input.Filters.SortSafelist = []string{"checked_out_at", "due_at", "-checked_out_at", "-due_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	loans, metadata, err := app.models.Loans.GetAll(criteria, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"loans": loans, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createReservationHandler() puts the user in the queue for a record. Queueing
+// only makes sense when every copy is spoken for, so a user who could check a copy out
+// straight away is told to do that instead.
+func (app *application) createReservationHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	err := app.attachAvailability(edToy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	switch {
+	case edToy.Availability.Copies == 0:
+		app.conflictResponse(w, r, "the library has no copies of this educational toy")
+		return
+	case edToy.Availability.Available > edToy.Availability.Reservations:
+		app.conflictResponse(w, r, "a copy is available, please check it out instead")
+		return
+	}
+	reservation := &data.Reservation{
+		EdtoyID: edToy.ID,
+		Title:   edToy.Title,
+		UserID:  app.contextGetUser(r).ID,
+	}
+	err = app.models.Reservations.Insert(reservation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReservation):
+			app.conflictResponse(w, r, "you have already reserved this educational toy")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"reservation": reservation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Reservations.DeleteForUser(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "reservation successfully cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listUserReservationsHandler(w http.ResponseWriter, r *http.Request) {
+	reservations, err := app.models.Reservations.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"reservations": reservations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The attachAvailability() helper fills in the Availability field of each record.
+func (app *application) attachAvailability(edToys ...*data.Edtoys) error {
+	if len(edToys) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(edToys))
+	for i, edToy := range edToys {
+		ids[i] = edToy.ID
+	}
+	availability, err := app.models.Loans.AvailabilityForEdtoys(ids...)
+	if err != nil {
+		return err
+	}
+	for _, edToy := range edToys {
+		edToy.Availability = availability[edToy.ID]
+	}
+	return nil
+}
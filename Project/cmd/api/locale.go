@@ -0,0 +1,83 @@
+package main
+
+import (
+	"Project/internal/data"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The negotiateLocales() helper reads the Accept-Language header and returns the
+// supported locales to try, most preferred first, with each one followed by its
+// fallbacks. A region subtag is ignored, so "ru-RU" selects ru. The chain stops at
+// data.DefaultLocale, since every record has content in it; without a usable header
+// the chain is just the default locale.
+func (app *application) negotiateLocales(r *http.Request) []string {
+	type languageRange struct {
+		tag string
+		q   float64
+	}
+	var ranges []languageRange
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		ranges = append(ranges, languageRange{tag: tag, q: q})
+	}
+	// A stable sort keeps ranges with equal weights in the order the client sent them.
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	var chain []string
+	seen := make(map[string]bool)
+	for _, lr := range ranges {
+		locale, _, _ := strings.Cut(lr.tag, "-")
+		if locale == "*" {
+			locale = data.DefaultLocale
+		}
+		if !data.SupportedLocale(locale) {
+			continue
+		}
+		for _, l := range data.LocaleFallbacks(locale) {
+			if !seen[l] {
+				seen[l] = true
+				chain = append(chain, l)
+			}
+		}
+		if seen[data.DefaultLocale] {
+			break
+		}
+	}
+	if !seen[data.DefaultLocale] {
+		chain = append(chain, data.DefaultLocale)
+	}
+	return chain
+}
+
+// The contentLanguage() helper returns the Content-Language value for a response made
+// up of the given records: the distinct locales they were served in, in order of first
+// appearance.
+func contentLanguage(edtoys ...*data.Edtoys) string {
+	var locales []string
+	seen := make(map[string]bool)
+	for _, e := range edtoys {
+		if e.Locale != "" && !seen[e.Locale] {
+			seen[e.Locale] = true
+			locales = append(locales, e.Locale)
+		}
+	}
+	return strings.Join(locales, ", ")
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"Project/internal/blob"
 	"Project/internal/data"
 	"Project/internal/jsonlog"
+	"Project/internal/jwt"
 	"Project/internal/mailer"
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"os"
 	"strings"
@@ -30,6 +33,21 @@ type config struct {
 		rps     float64
 		burst   int
 		enabled bool
+		// activationInterval is how often an activation email may be resent to the
+		// same address.
+		activationInterval time.Duration
+	}
+	auth struct {
+		accessTokenTTL  time.Duration
+		refreshTokenTTL time.Duration
+		// tokenMode picks the kind of access token that's issued: "opaque" tokens are
+		// looked up in the database on every request, while "signed" ones are
+		// HMAC-signed JWTs verified with jwtKeys alone.
+		tokenMode string
+		jwtKeys   string
+		jwtKeyID  string
+		// totpIssuer is the name authenticator apps show against the account.
+		totpIssuer string
 	}
 	smtp struct {
 		host     string
@@ -42,6 +60,18 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	media struct {
+		dir      string
+		baseURL  string
+		maxBytes int64
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	library struct {
+		loanPeriod time.Duration
+	}
 }
 
 type application struct {
@@ -49,7 +79,15 @@ type application struct {
 	logger *jsonlog.Logger
 	models data.Models
 	mailer mailer.Mailer
+	blobs  blob.Store
+	// signer verifies signed access tokens, and signs them in the signed token mode.
+	// It's nil when no keys are configured.
+	signer *jwt.Keyset
 	wg     sync.WaitGroup
+	// activationLimiter throttles activation emails per address.
+	activationLimiter *keyedLimiter
+	// mfaLimiter throttles attempts at a user's two-factor authentication code.
+	mfaLimiter *keyedLimiter
 }
 
 func main() {
@@ -63,6 +101,14 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.DurationVar(&cfg.limiter.activationInterval, "limiter-activation-interval", 5*time.Minute, "Minimum time between activation emails to the same address")
+
+	flag.DurationVar(&cfg.auth.accessTokenTTL, "access-token-ttl", 15*time.Minute, "How long an access (authentication) token is valid for")
+	flag.DurationVar(&cfg.auth.refreshTokenTTL, "refresh-token-ttl", 30*24*time.Hour, "How long a refresh token is valid for")
+	flag.StringVar(&cfg.auth.tokenMode, "token-mode", "opaque", "Kind of access token to issue (opaque|signed)")
+	flag.StringVar(&cfg.auth.jwtKeys, "jwt-keys", os.Getenv("GREENLIGHT_JWT_KEYS"), "Signing keys for signed access tokens, as comma separated kid:base64-secret pairs")
+	flag.StringVar(&cfg.auth.jwtKeyID, "jwt-key-id", "", "ID of the key that new signed access tokens are signed with")
+	flag.StringVar(&cfg.auth.totpIssuer, "totp-issuer", "Greenlight", "Issuer name shown in authenticator apps for two-factor authentication")
 
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP port")
@@ -75,8 +121,26 @@ func main() {
 		return nil
 	})
 
+	flag.StringVar(&cfg.media.dir, "media-dir", "./uploads", "Directory for uploaded media files")
+	flag.StringVar(&cfg.media.baseURL, "media-base-url", "/media", "Base URL that uploaded media files are served from")
+	flag.Int64Var(&cfg.media.maxBytes, "media-max-bytes", 5<<20, "Maximum size of an uploaded media file in bytes")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted records are kept before being purged (0 disables purging)")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often to purge expired deleted records")
+
+	flag.DurationVar(&cfg.library.loanPeriod, "loan-period", 14*24*time.Hour, "How long a toy library loan lasts before it is due back")
+
 	flag.Parse()
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	if cfg.trash.purgeInterval <= 0 {
+		logger.PrintFatal(errors.New("trash-purge-interval must be greater than zero"), nil)
+	}
+	// Media is served from a route under the base URL, so it must be a plain path. The
+	// trailing slash is dropped here so that the route and the blob store's URLs agree.
+	cfg.media.baseURL = strings.TrimSuffix(cfg.media.baseURL, "/")
+	if !strings.HasPrefix(cfg.media.baseURL, "/") || strings.ContainsAny(cfg.media.baseURL, ":*?#") {
+		logger.PrintFatal(errors.New("media-base-url must be a path starting with / such as /media"), nil)
+	}
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -84,18 +148,66 @@ func main() {
 	defer db.Close()
 	logger.PrintInfo("database connection pool established", nil)
 
+	blobs, err := blob.NewLocal(cfg.media.dir, cfg.media.baseURL)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	signer, err := openSigner(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	app := &application{
 		config: cfg,
 		logger: logger,
 		models: data.NewModels(db),
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		blobs:  blobs,
+		signer: signer,
+
+		activationLimiter: newKeyedLimiter(cfg.limiter.activationInterval, 1),
+		mfaLimiter:        newKeyedLimiter(30*time.Second, 5),
 	}
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
 }
 
+// openSigner() checks the token settings and builds the keyset for signed access
+// tokens. Keys can be configured in either token mode, so that tokens already handed
+// out keep working after switching back to opaque tokens; to rotate keys, add the new
+// key, point -jwt-key-id at it, and drop the old one once the tokens signed with it
+// have expired.
+func openSigner(cfg config) (*jwt.Keyset, error) {
+	switch cfg.auth.tokenMode {
+	case "opaque", "signed":
+	default:
+		return nil, errors.New("token-mode must be either opaque or signed")
+	}
+	// A zero TTL means "don't issue this token" to TokenModel.NewSession(), which every
+	// sign-in relies on getting.
+	if cfg.auth.accessTokenTTL <= 0 {
+		return nil, errors.New("access-token-ttl must be greater than zero")
+	}
+	if cfg.auth.refreshTokenTTL <= 0 {
+		return nil, errors.New("refresh-token-ttl must be greater than zero")
+	}
+	if cfg.auth.jwtKeys == "" {
+		if cfg.auth.tokenMode == "signed" {
+			return nil, errors.New("jwt-keys must be set when token-mode is signed")
+		}
+		return nil, nil
+	}
+	keys, err := jwt.ParseKeys(cfg.auth.jwtKeys)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.NewKeyset(cfg.auth.jwtKeyID, keys)
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/imaging"
+	"Project/internal/validator"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// The content types we accept for uploads, mapped to the file extension they are
+// stored with. These are the formats the imaging package can decode.
+var mediaContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// The longest edge of a generated thumbnail, in pixels.
+const thumbnailSize = 320
+
+// mediaFS serves the files in a directory without ever listing it. Media files are
+// stored under random names so that they can't be guessed, which a directory listing
+// would give away, so directories are reported as not existing and get a 404.
+type mediaFS struct {
+	fs http.FileSystem
+}
+
+func (m mediaFS) Open(name string) (http.File, error) {
+	f, err := m.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, os.ErrNotExist
+	}
+	return f, nil
+}
+
+func (app *application) uploadEdtoysMediaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	_, err = app.models.EdToys.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	content, err := app.readMultipartFile(w, r, "file", app.config.media.maxBytes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Don't trust the Content-Type sent by the client; sniff the bytes instead.
+	contentType := http.DetectContentType(content)
+	extension, ok := mediaContentTypes[contentType]
+	if !ok {
+		app.unsupportedMediaTypeResponse(w, r, "image/jpeg", "image/png", "image/gif")
+		return
+	}
+	thumbnail, width, height, err := imaging.Thumbnail(content, thumbnailSize)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrTooLarge):
+			v := validator.New()
+			v.AddError("file", fmt.Sprintf("must not be more than %d megapixels", imaging.MaxPixels/1_000_000))
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.badRequestResponse(w, r, errors.New("file could not be decoded as an image"))
+		}
+		return
+	}
+
+	name, err := randomName()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	media := &data.Media{
+		EdtoyID:      id,
+		ContentType:  contentType,
+		Size:         int64(len(content)),
+		Width:        width,
+		Height:       height,
+		Key:          fmt.Sprintf("edtoys/%d/%s%s", id, name, extension),
+		ThumbnailKey: fmt.Sprintf("edtoys/%d/%s_thumb.jpg", id, name),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	err = app.blobs.Put(ctx, media.Key, bytes.NewReader(content), contentType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.blobs.Put(ctx, media.ThumbnailKey, bytes.NewReader(thumbnail), "image/jpeg")
+	if err == nil {
+		err = app.models.Media.Insert(media)
+	}
+	if err != nil {
+		// Don't leave orphaned files behind if we couldn't record them.
+		app.deleteMediaBlobs(media)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.setMediaURLs(media)
+	headers := make(http.Header)
+	headers.Set("Location", media.URL)
+	err = app.writeJSON(w, http.StatusCreated, envelope{"media": media}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteEdtoysMediaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	mediaID, err := app.readIntParam(r, "mediaID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	media, err := app.models.Media.Delete(id, mediaID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.deleteMediaBlobs(media)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "media successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readMultipartFile() helper reads a single file field from a multipart/form-data
+// request body, which must be no larger than maxBytes. It's the multipart counterpart
+// to readJSON().
+func (app *application) readMultipartFile(w http.ResponseWriter, r *http.Request, field string, maxBytes int64) ([]byte, error) {
+	// Allow a little headroom over the file size for the multipart framing.
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+64*1024)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.New("body must be multipart/form-data")
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("body must contain a %q file field", field)
+		}
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				return nil, fmt.Errorf("file must not be larger than %d bytes", maxBytes)
+			}
+			return nil, errors.New("body contains badly-formed multipart data")
+		}
+		if part.FormName() != field || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		content, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+		part.Close()
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				return nil, fmt.Errorf("file must not be larger than %d bytes", maxBytes)
+			}
+			return nil, err
+		}
+		if int64(len(content)) > maxBytes {
+			return nil, fmt.Errorf("file must not be larger than %d bytes", maxBytes)
+		}
+		if len(content) == 0 {
+			return nil, errors.New("file must not be empty")
+		}
+		return content, nil
+	}
+}
+
+// The attachMedia() helper loads the media for the given records and fills in their
+// Media fields.
+func (app *application) attachMedia(edToys ...*data.Edtoys) error {
+	if len(edToys) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(edToys))
+	for i, edToy := range edToys {
+		ids[i] = edToy.ID
+	}
+	media, err := app.models.Media.GetAllForEdtoys(ids...)
+	if err != nil {
+		return err
+	}
+	for _, edToy := range edToys {
+		edToy.Media = media[edToy.ID]
+		for _, item := range edToy.Media {
+			app.setMediaURLs(item)
+		}
+	}
+	return nil
+}
+
+func (app *application) setMediaURLs(media *data.Media) {
+	media.URL = app.blobs.URL(media.Key)
+	media.ThumbnailURL = app.blobs.URL(media.ThumbnailKey)
+}
+
+// deleteMediaBlobs() removes the stored files for a media record. Failures are only
+// logged, since the database record is the source of truth.
+func (app *application) deleteMediaBlobs(media *data.Media) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, key := range []string{media.Key, media.ThumbnailKey} {
+		err := app.blobs.Delete(ctx, key)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"key": key})
+		}
+	}
+}
+
+// randomName() returns a random hex string used to name uploaded files, so that names
+// can't be guessed or collide.
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
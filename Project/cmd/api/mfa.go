@@ -0,0 +1,298 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/totp"
+	"Project/internal/validator"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// The createMFAEnrollmentHandler() starts setting up two-factor authentication for the
+// user, returning a new TOTP secret along with an otpauth:// URI for it that can be
+// shown as a QR code. Nothing changes at sign-in until the enrollment is confirmed.
+func (app *application) createMFAEnrollmentHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	secret, err := app.models.MFA.Enroll(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMFAAlreadyEnabled):
+			app.conflictResponse(w, r, "two-factor authentication is already enabled")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	env := envelope{"mfa": envelope{
+		"secret":      totp.EncodeSecret(secret),
+		"otpauth_uri": totp.URI(app.config.auth.totpIssuer, user.Email, secret),
+	}}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The confirmMFAEnrollmentHandler() turns on two-factor authentication once the user
+// has shown that their authenticator works by sending a code from it, and responds with
+// their recovery codes. These are only ever shown this once. Signed access tokens carry
+// the user's two-factor settings, so they don't see the change until refreshed.
+func (app *application) confirmMFAEnrollmentHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	if !app.allowMFAAttempt(user.ID) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+	codes, err := app.models.MFA.Confirm(user.ID, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.conflictResponse(w, r, "no two-factor authentication enrollment is in progress")
+		case errors.Is(err, data.ErrMFAAlreadyEnabled):
+			app.conflictResponse(w, r, "two-factor authentication is already enabled")
+		case errors.Is(err, data.ErrInvalidMFACode):
+			v.AddError("code", "is incorrect")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteMFAHandler() turns off two-factor authentication, given a code or recovery
+// code, unless an administrator has made it mandatory for the user.
+func (app *application) deleteMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateSecondFactor(v, input.Code, input.RecoveryCode); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	switch {
+	case !user.MFAEnabled:
+		app.conflictResponse(w, r, "two-factor authentication is not enabled")
+		return
+	case user.MFARequired:
+		app.conflictResponse(w, r, "two-factor authentication is required for your account")
+		return
+	}
+	if !app.allowMFAAttempt(user.ID) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+	ok, err := app.checkSecondFactor(user.ID, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.invalidSecondFactorResponse(w, r, input.Code)
+		return
+	}
+	err = app.models.MFA.Disable(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createRecoveryCodesHandler() replaces the user's recovery codes with a new set,
+// for when they've used up or lost the old ones.
+func (app *application) createRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateSecondFactor(v, input.Code, input.RecoveryCode); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	if !app.allowMFAAttempt(user.ID) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+	ok, err := app.checkSecondFactor(user.ID, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.invalidSecondFactorResponse(w, r, input.Code)
+		return
+	}
+	codes, err := app.models.MFA.ReplaceRecoveryCodes(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createMFAAuthenticationTokenHandler() is the second step of signing in with
+// two-factor authentication. It exchanges the mfa token from the first step, along with
+// a code or recovery code, for a new session.
+func (app *application) createMFAAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.MFAToken != "", "mfa_token", "must be provided")
+	v.Check(len(input.MFAToken) == 26, "mfa_token", "must be 26 bytes long")
+	data.ValidateSecondFactor(v, input.Code, input.RecoveryCode)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeMFA, input.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidMFATokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !app.allowMFAAttempt(user.ID) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+	ok, err := app.checkSecondFactor(user.ID, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.invalidMFACodeResponse(w, r)
+		return
+	}
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMFA, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.startSession(w, r, user)
+}
+
+// The updateUserMFARequirementHandler() lets an administrator make two-factor
+// authentication mandatory for a user, or optional again. A user it's required for who
+// hasn't set it up can still sign in, but can do nothing except set it up.
+func (app *application) updateUserMFARequirementHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Required *bool `json:"required"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if v.Check(input.Required != nil, "required", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.MFA.SetRequired(id, *input.Required)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The allowMFAAttempt() helper throttles attempts at a user's codes, so that the million
+// possible TOTP codes can't be worked through. Unlike the general rate limiter it can't
+// be switched off.
+func (app *application) allowMFAAttempt(userID int64) bool {
+	return app.mfaLimiter.Allow(strconv.FormatInt(userID, 10))
+}
+
+// The checkSecondFactor() helper reports whether the user has given a valid TOTP code
+// or, failing that, an unused recovery code, which is then used up.
+func (app *application) checkSecondFactor(userID int64, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		return app.models.MFA.Verify(userID, code)
+	}
+	return app.models.MFA.UseRecoveryCode(userID, recoveryCode)
+}
+
+// The invalidSecondFactorResponse() helper reports a wrong code or recovery code as a
+// validation error against whichever of the two was sent.
+func (app *application) invalidSecondFactorResponse(w http.ResponseWriter, r *http.Request, code string) {
+	v := validator.New()
+	if code != "" {
+		v.AddError("code", "is incorrect")
+	} else {
+		v.AddError("recovery_code", "is incorrect")
+	}
+	app.failedValidationResponse(w, r, v.Errors)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/jsonpatch"
+	"Project/internal/validator"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// edtoysDocument is the view of a record that merge patches and JSON Patches are
+// applied to. Unlike data.Edtoys it has no omitempty tags, so every editable field is
+// present for JSON Patch paths to point at. Version is included so that a patch can
+// test it, but it can't be changed.
+type edtoysDocument struct {
+	Title        string       `json:"title"`
+	Description  string       `json:"description"`
+	Year         int32        `json:"year"`
+	TargetAge    string       `json:"target_age"`
+	MinAgeMonths int32        `json:"min_age_months"`
+	MaxAgeMonths *int32       `json:"max_age_months"`
+	Genres       []string     `json:"genres"`
+	SkillFocus   []string     `json:"skill_focus"`
+	Runtime      data.Runtime `json:"runtime"`
+	Version      int32        `json:"version"`
+}
+
+// The patchEdtoys() helper reads a merge patch or JSON Patch from the request body and
+// applies it to the record. A field that ends up removed or null is cleared, which is
+// how a client empties skill_focus or makes the age range open-ended. It returns false
+// if it has already sent an error response.
+func (app *application) patchEdtoys(w http.ResponseWriter, r *http.Request, mediaType string, edToys *data.Edtoys, v *validator.Validator) bool {
+	original := edtoysDocument{
+		Title:        edToys.Title,
+		Description:  edToys.Description,
+		Year:         edToys.Year,
+		TargetAge:    edToys.TargetAge,
+		MinAgeMonths: edToys.MinAgeMonths,
+		MaxAgeMonths: edToys.MaxAgeMonths,
+		Genres:       edToys.Genres,
+		SkillFocus:   edToys.SkillFocus,
+		Runtime:      edToys.Runtime,
+		Version:      edToys.Version,
+	}
+	js, err := json.Marshal(original)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	var doc interface{}
+	err = json.Unmarshal(js, &doc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	switch mediaType {
+	case mergePatchContentType:
+		var patch interface{}
+		err = app.readJSON(w, r, &patch)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return false
+		}
+		if _, ok := patch.(map[string]interface{}); !ok {
+			app.badRequestResponse(w, r, errors.New("merge patch must be a JSON object"))
+			return false
+		}
+		doc = jsonpatch.MergePatch(doc, patch)
+	case jsonPatchContentType:
+		var ops []jsonpatch.Operation
+		err = app.readJSON(w, r, &ops)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return false
+		}
+		doc, err = jsonpatch.Apply(doc, ops)
+		if err != nil {
+			switch {
+			case errors.Is(err, jsonpatch.ErrTestFailed):
+				app.conflictResponse(w, r, err.Error())
+			default:
+				v.AddError("patch", err.Error())
+				app.failedValidationResponse(w, r, v.Errors)
+			}
+			return false
+		}
+	}
+
+	fields, ok := doc.(map[string]interface{})
+	if !ok {
+		v.AddError("patch", "the patched document must be a JSON object")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	// Treat null the same as a removed member, so both clear the field.
+	for key, value := range fields {
+		if value == nil {
+			delete(fields, key)
+		}
+	}
+	var patched edtoysDocument
+	if !app.decodePatchedDocument(fields, &patched, v) {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	// A version in the patched document has to match the record, the same as the
+	// optimistic lock applied by Update().
+	if _, ok := fields["version"]; ok && patched.Version != original.Version {
+		app.editConflictResponse(w, r)
+		return false
+	}
+
+	edToys.Title = patched.Title
+	edToys.Description = patched.Description
+	edToys.Year = patched.Year
+	edToys.Genres = patched.Genres
+	edToys.SkillFocus = patched.SkillFocus
+	if edToys.SkillFocus == nil {
+		edToys.SkillFocus = []string{}
+	}
+	edToys.Runtime = patched.Runtime
+
+	// target_age is derived from the age range, so it can be changed or the range can
+	// be, but not both at once. Being read-only output, it can't be cleared, so a patch
+	// that removes it or sets it to null leaves the range alone.
+	_, hasTargetAge := fields["target_age"]
+	targetAgeChanged := hasTargetAge && patched.TargetAge != original.TargetAge
+	rangeChanged := patched.MinAgeMonths != original.MinAgeMonths || !equalInt32Ptr(patched.MaxAgeMonths, original.MaxAgeMonths)
+	switch {
+	case targetAgeChanged && rangeChanged:
+		v.AddError("target_age", "must not be combined with min_age_months or max_age_months")
+	case targetAgeChanged:
+		if err := edToys.SetTargetAge(patched.TargetAge); err != nil {
+			v.AddError("target_age", "must be in a format like 3+, 4-6 years or 18-36 months")
+		}
+	default:
+		edToys.MinAgeMonths = patched.MinAgeMonths
+		edToys.MaxAgeMonths = patched.MaxAgeMonths
+	}
+	return true
+}
+
+// decodePatchedDocument() decodes the patched fields back into an edtoysDocument,
+// recording anything that no longer fits as a validation error.
+func (app *application) decodePatchedDocument(fields map[string]interface{}, dst *edtoysDocument, v *validator.Validator) bool {
+	js, err := json.Marshal(fields)
+	if err != nil {
+		v.AddError("patch", err.Error())
+		return false
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(dst)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &unmarshalTypeError):
+			v.AddError(unmarshalTypeError.Field, "has the wrong JSON type")
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			v.AddError("runtime", `must be in the format "<number> mins"`)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			v.AddError("patch", "unknown field "+strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			v.AddError("patch", err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+func equalInt32Ptr(a, b *int32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
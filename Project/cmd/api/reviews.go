@@ -0,0 +1,182 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"errors"
+	"net/http"
+)
+
+// The edtoyFromParam() helper reads the :id parameter and checks that the record exists,
+// writing the error response itself when it doesn't. The second return value reports
+// whether the caller should carry on.
+func (app *application) edtoyFromParam(w http.ResponseWriter, r *http.Request) (*data.Edtoys, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	edToy, err := app.models.EdToys.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return edToy, true
+}
+
+func (app *application) createReviewHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Rating int    `json:"rating"`
+		Title  string `json:"title"`
+		Body   string `json:"body"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	review := &data.Review{
+		EdtoyID: edToy.ID,
+		UserID:  app.contextGetUser(r).ID,
+		Rating:  input.Rating,
+		Title:   input.Title,
+		Body:    input.Body,
+	}
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Reviews.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			v.AddError("review", "you have already reviewed this educational toy")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	review.UserName = app.contextGetUser(r).Name
+	err = app.writeJSON(w, http.StatusCreated, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "rating", "-created_at", "-rating"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	reviews, metadata, err := app.models.Reviews.GetAllForEdtoy(edToy.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateReviewHandler() edits the caller's own review of the record. Users only
+// ever have one review per record, so there's no need for a review ID in the URL.
+func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	review, err := app.models.Reviews.GetForUser(edToy.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var input struct {
+		Rating *int    `json:"rating"`
+		Title  *string `json:"title"`
+		Body   *string `json:"body"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+	if input.Title != nil {
+		review.Title = *input.Title
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Reviews.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Reviews.DeleteForUser(edToy.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
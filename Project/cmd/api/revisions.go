@@ -0,0 +1,103 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"errors"
+	"net/http"
+)
+
+func (app *application) listEdtoysRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// Make sure the record itself exists, so that an unknown ID gets a 404 rather than
+	// an empty history.
+	_, err = app.models.EdToys.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	revisions, err := app.models.Revisions.GetAllForEdtoy(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The revertEdtoysHandler() restores the values a record held at an earlier version.
+// The revert is itself saved as a normal update, so it shows up in the history and can
+// be undone in turn.
+func (app *application) revertEdtoysHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	version, err := app.readIntParam(r, "version")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	edToys, err := app.models.EdToys.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	revision, err := app.models.Revisions.Get(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revision.Snapshot.Apply(edToys)
+
+	// The rules may have tightened since the revision was written, so check it again.
+	// Older revisions may also predate the taxonomy, so map their terms to slugs.
+	taxonomy, err := app.models.Taxonomy.Load()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	taxonomy.Canonicalize(edToys)
+	v := validator.New()
+	if data.ValidateEdtoys(v, edToys, taxonomy); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.EdToys.Update(edToys, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"educational_toys": edToys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"Project/internal/blob"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"strings"
 )
 
 func (app *application) routes() http.Handler {
@@ -15,14 +17,101 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/edtoys", app.requirePermission("edtoys:read", app.listEdToysHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/edtoys", app.requirePermission("edtoys:write", app.createEdtoysHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/edtoys/:id", app.requirePermission("edtoys:read", app.showEdtoysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/edtoys/:id", app.namedOrID(map[string]http.HandlerFunc{
+		"import": app.requirePermission("edtoys:write", app.importEdtoysHandler),
+	}, app.notFoundResponse))
+	router.HandlerFunc(http.MethodGet, "/v1/edtoys/:id", app.namedOrID(map[string]http.HandlerFunc{
+		"export": app.requirePermission("edtoys:read", app.exportEdtoysHandler),
+		"trash":  app.requirePermission("edtoys:write", app.listDeletedEdtoysHandler),
+	}, app.requirePermission("edtoys:read", app.showEdtoysHandler)))
 	router.HandlerFunc(http.MethodPatch, "/v1/edtoys/:id", app.requirePermission("edtoys:write", app.updateEdToysHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/edtoys/:id", app.requirePermission("edtoys:write", app.deleteEdToysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/edtoys/:id/restore", app.requirePermission("edtoys:write", app.restoreEdtoysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/edtoys/:id/media", app.requirePermission("edtoys:write", app.uploadEdtoysMediaHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/edtoys/:id/media/:mediaID", app.requirePermission("edtoys:write", app.deleteEdtoysMediaHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/edtoys/:id/similar", app.requirePermission("edtoys:read", app.showSimilarEdtoysHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/edtoys/:id/revisions", app.requirePermission("edtoys:read", app.listEdtoysRevisionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/edtoys/:id/revisions/:version/revert", app.requirePermission("edtoys:write", app.revertEdtoysHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/edtoys/:id/reviews", app.requirePermission("edtoys:read", app.listReviewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/edtoys/:id/reviews", app.requirePermission("edtoys:read", app.createReviewHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/edtoys/:id/reviews", app.requirePermission("edtoys:read", app.updateReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/edtoys/:id/reviews", app.requirePermission("edtoys:read", app.deleteReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/edtoys/:id/translations", app.requirePermission("edtoys:read", app.listTranslationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/edtoys/:id/translations/:locale", app.requirePermission("edtoys:read", app.showTranslationHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/edtoys/:id/translations/:locale", app.requirePermission("edtoys:write", app.putTranslationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/edtoys/:id/translations/:locale", app.requirePermission("edtoys:write", app.deleteTranslationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/edtoys/:id/copies", app.requirePermission("edtoys:read", app.listCopiesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/edtoys/:id/copies", app.requirePermission("edtoys:write", app.createCopyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/edtoys/:id/copies/:copyID", app.requirePermission("edtoys:write", app.retireCopyHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/edtoys/:id/checkout", app.requirePermission("edtoys:read", app.checkoutEdtoysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/edtoys/:id/reservations", app.requirePermission("edtoys:read", app.createReservationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/edtoys/:id/reservations", app.requirePermission("edtoys:read", app.deleteReservationHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/taxonomy/:kind", app.requirePermission("edtoys:read", app.listTermsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/taxonomy/:kind", app.requirePermission("taxonomy:write", app.createTermHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/taxonomy/:kind/:slug", app.requirePermission("edtoys:read", app.showTermHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/taxonomy/:kind/:slug", app.requirePermission("taxonomy:write", app.updateTermHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/taxonomy/:kind/:slug", app.requirePermission("taxonomy:write", app.deleteTermHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/taxonomy/:kind/:slug/merge", app.requirePermission("taxonomy:write", app.mergeTermHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/loans", app.requirePermission("edtoys:write", app.listLoansHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/loans/:id/return", app.requireActivatedUser(app.returnLoanHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/wishlists", app.requireActivatedUser(app.listWishlistsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/wishlists", app.requireActivatedUser(app.createWishlistHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/wishlists/:id", app.requireActivatedUser(app.showWishlistHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/wishlists/:id", app.requireActivatedUser(app.updateWishlistHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/wishlists/:id", app.requireActivatedUser(app.deleteWishlistHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/wishlists/:id/items", app.requireActivatedUser(app.addWishlistItemHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/wishlists/:id/items", app.requireActivatedUser(app.reorderWishlistItemsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/wishlists/:id/items/:edtoyID", app.requireActivatedUser(app.removeWishlistItemHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/wishlists/:id/share", app.requireActivatedUser(app.shareWishlistHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/wishlists/:id/share", app.requireActivatedUser(app.unshareWishlistHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireAuthenticatedUser(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireAuthenticatedUser(app.deleteSessionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/mfa", app.requireAuthenticatedUser(app.createMFAEnrollmentHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/mfa", app.requireAuthenticatedUser(app.confirmMFAEnrollmentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/mfa", app.requireAuthenticatedUser(app.deleteMFAHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/mfa/recovery-codes", app.requireAuthenticatedUser(app.createRecoveryCodesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/loans", app.requireActivatedUser(app.listUserLoansHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/reservations", app.requireActivatedUser(app.listUserReservationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/wishlists/:token", app.showSharedWishlistHandler)
+
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/mfa", app.requirePermission("edtoys:write", app.updateUserMFARequirementHandler))
 
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/mfa", app.createMFAAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+
+	// When media is kept on the local filesystem, serve it ourselves, to the same users
+	// who can read the records it belongs to.
+	if local, ok := app.blobs.(*blob.LocalStore); ok {
+		baseURL := strings.TrimSuffix(app.config.media.baseURL, "/")
+		files := http.StripPrefix(baseURL, http.FileServer(mediaFS{http.Dir(local.Root())}))
+		router.HandlerFunc(http.MethodGet, baseURL+"/*filepath", app.requirePermission("edtoys:read", files.ServeHTTP))
+	}
 
 	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
 }
+
+// httprouter doesn't allow a fixed path segment to sit alongside a wildcard, so routes
+// such as GET /v1/edtoys/export can't be registered next to GET /v1/edtoys/:id. The
+// namedOrID() helper works around this by dispatching on the :id parameter: a value
+// found in the named map goes to that handler, anything else is treated as an ID.
+func (app *application) namedOrID(named map[string]http.HandlerFunc, byID http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if next, ok := named[params.ByName("id")]; ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		byID.ServeHTTP(w, r)
+	}
+}
@@ -20,6 +20,15 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Start the trash purger, tracked by the WaitGroup so that shutdown waits for a purge
+	// that's under way to finish.
+	stopPurge := make(chan struct{})
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		app.purgeTrash(stopPurge)
+	}()
+
 	shutdownError := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -41,6 +50,7 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
+		close(stopPurge)
 		// Call Wait() to block until our WaitGroup counter is zero --- essentially
 		// blocking until the background goroutines have finished. Then we return nil on
 		// the shutdownError channel, to indicate that the shutdown completed without
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"net/http"
+)
+
+// The showSimilarEdtoysHandler() returns the records most like the given one, for
+// "you may also like" suggestions. Clients can shift the balance between the signals
+// with the weight_* parameters.
+func (app *application) showSimilarEdtoysHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	defaults := data.DefaultSimilarityWeights
+	weights := data.SimilarityWeights{
+		Genres:     app.readFloat(qs, "weight_genres", defaults.Genres, v),
+		SkillFocus: app.readFloat(qs, "weight_skill_focus", defaults.SkillFocus, v),
+		Age:        app.readFloat(qs, "weight_age", defaults.Age, v),
+		Year:       app.readFloat(qs, "weight_year", defaults.Year, v),
+	}
+	limit := app.readInt(qs, "limit", 10, v)
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 50, "limit", "must be a maximum of 50")
+	if data.ValidateSimilarityWeights(v, weights); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	similar, err := app.models.EdToys.Similar(edToy, weights, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.attachMedia(similar...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"educational_toys": similar}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// The :kind segment of the taxonomy routes, mapped to the term kind it names.
+var termKinds = map[string]string{
+	"genres": data.TermKindGenre,
+	"skills": data.TermKindSkill,
+}
+
+// The taxonomyTerm() helper fetches the term named by the :kind and :slug parameters,
+// writing the error response itself when it can't. The second return value reports
+// whether the caller should carry on.
+func (app *application) taxonomyTerm(w http.ResponseWriter, r *http.Request) (*data.Term, bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	kind, ok := termKinds[params.ByName("kind")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	term, err := app.models.Taxonomy.Get(kind, params.ByName("slug"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return term, true
+}
+
+func (app *application) listTermsHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := termKinds[httprouter.ParamsFromContext(r.Context()).ByName("kind")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+	terms, err := app.models.Taxonomy.GetAll(kind)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"terms": terms}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showTermHandler(w http.ResponseWriter, r *http.Request) {
+	term, ok := app.taxonomyTerm(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"term": term}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createTermHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := termKinds[httprouter.ParamsFromContext(r.Context()).ByName("kind")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Slug     string   `json:"slug"`
+		Name     string   `json:"name"`
+		Parent   string   `json:"parent"`
+		Synonyms []string `json:"synonyms"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	term := &data.Term{
+		Kind:     kind,
+		Slug:     input.Slug,
+		Name:     input.Name,
+		Parent:   input.Parent,
+		Synonyms: input.Synonyms,
+	}
+	if term.Synonyms == nil {
+		term.Synonyms = []string{}
+	}
+	v := validator.New()
+	if data.ValidateTerm(v, term); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Taxonomy.Insert(term)
+	if err != nil {
+		app.termWriteError(w, r, v, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"term": term}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateTermHandler(w http.ResponseWriter, r *http.Request) {
+	term, ok := app.taxonomyTerm(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Name     *string  `json:"name"`
+		Parent   *string  `json:"parent"`
+		Synonyms []string `json:"synonyms"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		term.Name = *input.Name
+	}
+	if input.Parent != nil {
+		term.Parent = *input.Parent
+	}
+	if input.Synonyms != nil {
+		term.Synonyms = input.Synonyms
+	}
+	v := validator.New()
+	if data.ValidateTerm(v, term); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Taxonomy.Update(term)
+	if err != nil {
+		app.termWriteError(w, r, v, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"term": term}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTermHandler(w http.ResponseWriter, r *http.Request) {
+	term, ok := app.taxonomyTerm(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Taxonomy.Delete(term)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTermInUse):
+			app.conflictResponse(w, r, "the term is still used by educational toys, merge it into another term instead")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "term successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The mergeTermHandler() folds one term into another, e.g. "science" into "stem". Every
+// record using the old term is switched over and the old term lives on as a synonym.
+func (app *application) mergeTermHandler(w http.ResponseWriter, r *http.Request) {
+	from, ok := app.taxonomyTerm(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Into string `json:"into"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Into != "", "into", "must be provided")
+	v.Check(input.Into != from.Slug, "into", "must be a different term")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	into, err := app.models.Taxonomy.Get(from.Kind, input.Into)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("into", "must be an existing term of the same kind")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	changed, err := app.models.Taxonomy.Merge(from, into, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	into, err = app.models.Taxonomy.Get(into.Kind, into.Slug)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"term": into, "updated_educational_toys": changed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// termWriteError() sends the response for an error from inserting or updating a term.
+func (app *application) termWriteError(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, data.ErrDuplicateTerm):
+		v.AddError("slug", "a term with this slug already exists")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrDuplicateSynonym):
+		v.AddError("synonyms", "contains a synonym already used by another term")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("parent", "must be an existing term of the same kind")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrTermCycle):
+		v.AddError("parent", "must not be one of the term's own descendants")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrEditConflict):
+		app.editConflictResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
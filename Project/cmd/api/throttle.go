@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// keyedLimiter is a set of token bucket rate limiters, one per key, for throttling
+// something other than the client IP address, such as the emails sent to an address.
+// Like the limiters in rateLimit(), idle entries are dropped by a background goroutine.
+type keyedLimiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	entries map[string]*keyedLimiterEntry
+}
+
+type keyedLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newKeyedLimiter() returns a keyedLimiter allowing burst events per key at once, with
+// another one allowed every interval after that.
+func newKeyedLimiter(interval time.Duration, burst int) *keyedLimiter {
+	l := &keyedLimiter{
+		limit:   rate.Every(interval),
+		burst:   burst,
+		entries: make(map[string]*keyedLimiterEntry),
+	}
+	// An entry that has been idle for long enough to refill its bucket behaves the
+	// same as a new one, so it's safe to forget it.
+	idle := interval * time.Duration(burst)
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			l.mu.Lock()
+			for key, entry := range l.entries {
+				if time.Since(entry.lastSeen) > idle {
+					delete(l.entries, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}()
+	return l
+}
+
+// Allow() reports whether an event for the key may happen now, using up one token from
+// the key's bucket if so.
+func (l *keyedLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, found := l.entries[key]
+	if !found {
+		entry = &keyedLimiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.entries[key] = entry
+	}
+	entry.lastSeen = time.Now()
+	return entry.limiter.Allow()
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"Project/internal/data"
+	"Project/internal/jwt"
 	"Project/internal/validator"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -44,12 +47,298 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	// With two-factor authentication on, the password only earns a short-lived mfa
+	// token, which has to be exchanged along with a code at POST /v1/tokens/mfa.
+	if user.MFAEnabled {
+		token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeMFA)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.writeJSON(w, http.StatusAccepted, envelope{"mfa_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.startSession(w, r, user)
+}
+
+// The startSession() helper signs the user in, responding with a new session made up
+// of a short-lived access token for calling the API and a long-lived refresh token for
+// getting new access tokens.
+func (app *application) startSession(w http.ResponseWriter, r *http.Request, user *data.User) {
+	access, refresh, err := app.models.Tokens.NewSession(user.ID, app.opaqueAccessTTL(), app.config.auth.refreshTokenTTL, clientIP(r), clientUserAgent(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if access == nil {
+		access, err = app.signAccessToken(user, refresh.FamilyID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The refreshAuthenticationTokenHandler() exchanges a refresh token for a new access
+// token and refresh token. Each refresh token works once; if one is used again, it has
+// probably been stolen, so the whole session is revoked and the client has to sign in
+// again.
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.RefreshToken != "", "refresh_token", "must be provided")
+	v.Check(len(input.RefreshToken) == 26, "refresh_token", "must be 26 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	access, refresh, err := app.models.Tokens.Refresh(input.RefreshToken, app.opaqueAccessTTL(), app.config.auth.refreshTokenTTL, clientIP(r), clientUserAgent(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			app.logger.PrintInfo("refresh token reused, session revoked", map[string]string{"ip": clientIP(r)})
+			app.invalidRefreshTokenResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if access == nil {
+		// The user's name, activation and permissions are read afresh, so a signed
+		// token never carries them for longer than one access token lifetime.
+		user, err := app.models.Users.Get(refresh.UserID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		access, err = app.signAccessToken(user, refresh.FamilyID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The opaqueAccessTTL() helper returns the lifetime for opaque access tokens issued
+// along with a refresh token, which is zero in the signed token mode so that none are
+// stored.
+func (app *application) opaqueAccessTTL() time.Duration {
+	if app.config.auth.tokenMode == "signed" {
+		return 0
+	}
+	return app.config.auth.accessTokenTTL
+}
+
+// The signAccessToken() helper issues a signed access token for a user's session. It
+// carries the user's permissions as they stand now, so a change to them takes effect
+// when the token is next refreshed.
+func (app *application) signAccessToken(user *data.User, sessionID int64) (*data.Token, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiry := now.Add(app.config.auth.accessTokenTTL)
+	claims := jwt.Claims{
+		Subject:     strconv.FormatInt(user.ID, 10),
+		Session:     sessionID,
+		Name:        user.Name,
+		Activated:   user.Activated,
+		MFAEnabled:  user.MFAEnabled,
+		MFARequired: user.MFARequired,
+		Permissions: permissions,
+		IssuedAt:    now.Unix(),
+		Expiry:      expiry.Unix(),
+	}
+	plaintext, err := app.signer.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &data.Token{
+		Plaintext: plaintext,
+		UserID:    user.ID,
+		Expiry:    time.Unix(expiry.Unix(), 0),
+		Scope:     data.ScopeAuthentication,
+	}, nil
+}
+
+// The createActivationTokenHandler() replaces a user's activation token and emails the
+// new one, for when the welcome email went missing or its token expired. Requests are
+// throttled per email address before the address is looked up, and the response is
+// the same whether or not it belongs to an account awaiting activation, so neither
+// gives away who has signed up.
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if app.config.limiter.enabled && !app.activationLimiter.Allow(strings.ToLower(input.Email)) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err == nil && !user.Activated {
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.background(func() {
+			data := map[string]interface{}{
+				"activationToken": token.Plaintext,
+			}
+			err = app.mailer.Send(user.Email, "token_activation.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+	env := envelope{"message": "if that email address belongs to an account awaiting activation, an email will be sent to it containing activation instructions"}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createPasswordResetTokenHandler() emails a password reset token to the owner of
+// an account. It responds the same way whether or not the email address belongs to an
+// activated account, so it can't be used to find out who has signed up.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err == nil && user.Activated {
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.background(func() {
+			data := map[string]interface{}{
+				"passwordResetToken": token.Plaintext,
+			}
+			err = app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+	env := envelope{"message": "if that email address belongs to an activated account, an email will be sent to it containing password reset instructions"}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteAuthenticationTokenHandler() logs out by revoking the session that the
+// request's access token belongs to, including its refresh token. A signed access token
+// can't be revoked, but it stops working when it expires shortly afterwards.
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.currentSessionID(r)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Tokens.DeleteSessionForUser(sessionID, app.contextGetUser(r).ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.currentSessionID(r)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	sessions, err := app.models.Tokens.GetSessionsForUser(app.contextGetUser(r).ID, sessionID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteSessionHandler() revokes one of the user's sessions, such as one left
+// signed in on a lost device.
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Tokens.DeleteSessionForUser(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func (app *application) listTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	translations, err := app.models.Translations.GetAllForEdtoy(edToy.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"translations": translations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	locale := httprouter.ParamsFromContext(r.Context()).ByName("locale")
+	translation, err := app.models.Translations.Get(edToy.ID, locale)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Content-Language", translation.Locale)
+	err = app.writeJSON(w, http.StatusOK, envelope{"translation": translation}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The putTranslationHandler() creates or replaces the translation of a record into the
+// locale named in the URL, responding 201 Created for a new translation and 200 OK for
+// a replaced one.
+func (app *application) putTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	translation := &data.Translation{
+		EdtoyID:     edToy.ID,
+		Locale:      httprouter.ParamsFromContext(r.Context()).ByName("locale"),
+		Title:       input.Title,
+		Description: input.Description,
+	}
+	v := validator.New()
+	if data.ValidateTranslation(v, translation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	created, err := app.models.Translations.Put(translation)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	status := http.StatusOK
+	headers := make(http.Header)
+	headers.Set("Content-Language", translation.Locale)
+	if created {
+		status = http.StatusCreated
+		headers.Set("Location", fmt.Sprintf("/v1/edtoys/%d/translations/%s", edToy.ID, translation.Locale))
+	}
+	err = app.writeJSON(w, status, envelope{"translation": translation}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	edToy, ok := app.edtoyFromParam(w, r)
+	if !ok {
+		return
+	}
+	locale := httprouter.ParamsFromContext(r.Context()).ByName("locale")
+	err := app.models.Translations.Delete(edToy.ID, locale)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "translation successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (app *application) listDeletedEdtoysHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// Most recently deleted records come first unless the client asks otherwise.
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	edToys, metadata, err := app.models.EdToys.GetAllDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"educational_toys": edToys, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreEdtoysHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	edToy, err := app.models.EdToys.Restore(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"educational_toys": edToy}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The purgeTrash() method permanently deletes records which have sat in the trash for
+// longer than the configured retention period, once straight away and then every purge
+// interval, until the stop channel is closed. The stored files of their media are
+// deleted once the records are gone. A zero retention period disables purging
+// altogether.
+func (app *application) purgeTrash(stop <-chan struct{}) {
+	if app.config.trash.retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+	for {
+		removed, media, err := app.models.EdToys.Purge(app.config.trash.retention)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		} else if removed > 0 {
+			for _, item := range media {
+				app.deleteMediaBlobs(item)
+			}
+			app.logger.PrintInfo("purged deleted educational toys", map[string]string{
+				"count": strconv.FormatInt(removed, 10),
+			})
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"Project/internal/data"
+	"Project/internal/validator"
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// The ownWishlist() helper fetches the wishlist named by the :id parameter, provided it
+// belongs to the current user, and writes the error response itself when it can't. The
+// second return value reports whether the caller should carry on.
+func (app *application) ownWishlist(w http.ResponseWriter, r *http.Request) (*data.Wishlist, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	wishlist, err := app.models.Wishlists.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return wishlist, true
+}
+
+func (app *application) listWishlistsHandler(w http.ResponseWriter, r *http.Request) {
+	wishlists, err := app.models.Wishlists.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"wishlists": wishlists}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	wishlist := &data.Wishlist{
+		UserID: app.contextGetUser(r).ID,
+		Name:   input.Name,
+	}
+	v := validator.New()
+	if data.ValidateWishlist(v, wishlist); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Wishlists.Insert(wishlist)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"wishlist": wishlist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := app.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"wishlist": wishlist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := app.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Name *string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		wishlist.Name = *input.Name
+	}
+	v := validator.New()
+	if data.ValidateWishlist(v, wishlist); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Wishlists.Update(wishlist)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"wishlist": wishlist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Wishlists.Delete(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "wishlist successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addWishlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := app.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		EdtoyID int64 `json:"edtoy_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	_, err = app.models.EdToys.Get(input.EdtoyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("edtoy_id", "must refer to an existing educational toy")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Wishlists.AddItem(wishlist.ID, input.EdtoyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateWishlistItem):
+			v.AddError("edtoy_id", "is already on this wishlist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeWishlist(w, r, wishlist, http.StatusCreated)
+}
+
+// The reorderWishlistItemsHandler() takes the complete list of record IDs on the
+// wishlist in their new order.
+func (app *application) reorderWishlistItemsHandler(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := app.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		EdtoyIDs []int64 `json:"edtoy_ids"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// The new order must be a permutation of the items already on the wishlist.
+	current := make(map[int64]bool, len(wishlist.Items))
+	for _, item := range wishlist.Items {
+		current[item.EdToy.ID] = true
+	}
+	v := validator.New()
+	seen := make(map[int64]bool, len(input.EdtoyIDs))
+	for _, id := range input.EdtoyIDs {
+		v.Check(current[id], "edtoy_ids", "must only contain items on the wishlist")
+		v.Check(!seen[id], "edtoy_ids", "must not contain duplicate values")
+		seen[id] = true
+	}
+	v.Check(len(seen) == len(current), "edtoy_ids", "must list every item on the wishlist")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Wishlists.Reorder(wishlist.ID, input.EdtoyIDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.writeWishlist(w, r, wishlist, http.StatusOK)
+}
+
+func (app *application) removeWishlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := app.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	edtoyID, err := app.readIntParam(r, "edtoyID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Wishlists.RemoveItem(wishlist.ID, edtoyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeWishlist(w, r, wishlist, http.StatusOK)
+}
+
+// The shareWishlistHandler() issues a new share link for the wishlist. The token is
+// only returned here, so calling it again is how an owner gets a fresh link (and
+// revokes the old one).
+func (app *application) shareWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := app.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	token, err := app.models.Wishlists.Share(wishlist)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"wishlist":    wishlist,
+		"share_token": token,
+		"share_path":  "/v1/wishlists/" + token,
+	}
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unshareWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := app.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Wishlists.Unshare(wishlist)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"wishlist": wishlist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showSharedWishlistHandler() serves a wishlist through its share link. It needs no
+// authentication; knowing the token is enough.
+func (app *application) showSharedWishlistHandler(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+	wishlist, err := app.models.Wishlists.GetForShareToken(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"wishlist": wishlist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeWishlist() re-reads a wishlist after its items have changed and sends it back.
+func (app *application) writeWishlist(w http.ResponseWriter, r *http.Request, wishlist *data.Wishlist, status int) {
+	wishlist, err := app.models.Wishlists.Get(wishlist.ID, wishlist.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, status, envelope{"wishlist": wishlist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
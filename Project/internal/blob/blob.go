@@ -0,0 +1,100 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Store is the interface that media storage backends implement. Keys are slash
+// separated paths such as "edtoys/12/4f3a.jpg", and URL() returns the address that
+// clients can fetch a stored object from.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// LocalStore keeps blobs as files underneath a root directory on the local filesystem.
+// It expects the application to serve that directory at baseURL.
+type LocalStore struct {
+	root    string
+	baseURL string
+}
+
+// NewLocal returns a LocalStore rooted at the given directory, creating it if needed.
+func NewLocal(root, baseURL string) (*LocalStore, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalStore{root: root, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Root returns the directory that the store writes to.
+func (s *LocalStore) Root() string {
+	return s.root
+}
+
+// path() maps a key onto a file path, rejecting anything that would escape the root.
+func (s *LocalStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean != "/"+key {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the blob to a temporary file first and then renames it into place, so a
+// half-written file is never visible under its final name.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Delete removes a blob. Deleting a blob that doesn't exist is not an error.
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + "/" + (&url.URL{Path: key}).EscapedPath()
+}
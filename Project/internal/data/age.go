@@ -0,0 +1,67 @@
+package data
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidTargetAgeFormat = errors.New("invalid target age format")
+
+// The oldest age, in months, that an age range may refer to.
+const maxAgeMonths = 1199
+
+// targetAgeRX matches the free-form age strings that the catalog has historically used,
+// such as "3+", "3+ years", "4-6 years", "18-36 months" and "6m+". The same pattern is
+// used by migration 000012 to convert the existing rows.
+var targetAgeRX = regexp.MustCompile(`^(\d{1,3})\s*(?:(?:-|–|to)\s*(\d{1,3}))?\s*(\+)?\s*(years?|yrs?|y|months?|mos?|m)?\s*(\+)?$`)
+
+// ParseTargetAge() converts a legacy target age string into an age range in months. A
+// "+" suffix leaves the range open-ended, in which case max is nil. Ages given in years
+// cover the whole of the final year, so "4-6 years" runs from 48 to 83 months. A range
+// whose end comes before its start gives ErrInvalidTargetAgeFormat.
+func ParseTargetAge(s string) (min int32, max *int32, err error) {
+	parts := targetAgeRX.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if parts == nil {
+		return 0, nil, ErrInvalidTargetAgeFormat
+	}
+
+	from, _ := strconv.ParseInt(parts[1], 10, 32)
+	to := from
+	if parts[2] != "" {
+		to, _ = strconv.ParseInt(parts[2], 10, 32)
+	}
+	// A range that runs backwards, such as "6-4 years", is as meaningless as one that
+	// can't be parsed at all.
+	if to < from {
+		return 0, nil, ErrInvalidTargetAgeFormat
+	}
+	openEnded := parts[2] == "" && (parts[3] != "" || parts[5] != "")
+
+	if strings.HasPrefix(parts[4], "m") {
+		min = int32(from)
+		to := int32(to)
+		max = &to
+	} else {
+		min = int32(from) * 12
+		to := int32(to)*12 + 11
+		max = &to
+	}
+	if openEnded {
+		max = nil
+	}
+	return min, max, nil
+}
+
+// SetTargetAge() parses a legacy target age string and stores the resulting range on
+// the record.
+func (e *Edtoys) SetTargetAge(s string) error {
+	min, max, err := ParseTargetAge(s)
+	if err != nil {
+		return err
+	}
+	e.MinAgeMonths = min
+	e.MaxAgeMonths = max
+	return nil
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseTargetAge(t *testing.T) {
+	months := func(n int32) *int32 { return &n }
+	tests := []struct {
+		input   string
+		wantMin int32
+		wantMax *int32
+	}{
+		{"3+", 36, nil},
+		{"3+ years", 36, nil},
+		{" 3+ YEARS ", 36, nil},
+		{"4-6", 48, months(83)},
+		{"4-6 years", 48, months(83)},
+		{"4 - 6 yrs", 48, months(83)},
+		{"4 to 6 y", 48, months(83)},
+		{"4–6 years", 48, months(83)},
+		{"2", 24, months(35)},
+		{"1 year", 12, months(23)},
+		{"18-36 months", 18, months(36)},
+		{"0-12 mos", 0, months(12)},
+		{"9 months", 9, months(9)},
+		{"6m+", 6, nil},
+		{"6 months+", 6, nil},
+		{"6+ months", 6, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			min, max, err := ParseTargetAge(tt.input)
+			if err != nil {
+				t.Fatalf("ParseTargetAge error = %v", err)
+			}
+			if min != tt.wantMin {
+				t.Errorf("min = %d, want %d", min, tt.wantMin)
+			}
+			switch {
+			case tt.wantMax == nil && max != nil:
+				t.Errorf("max = %d, want open-ended", *max)
+			case tt.wantMax != nil && max == nil:
+				t.Errorf("max = open-ended, want %d", *tt.wantMax)
+			case tt.wantMax != nil && *max != *tt.wantMax:
+				t.Errorf("max = %d, want %d", *max, *tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestParseTargetAgeInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"toddlers",
+		"three",
+		"3-",
+		"-3",
+		"3.5",
+		"1000",
+		"3-6-9",
+		"3 decades",
+		"6-4 years",
+		"36-18 months",
+	}
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			_, _, err := ParseTargetAge(input)
+			if !errors.Is(err, ErrInvalidTargetAgeFormat) {
+				t.Errorf("ParseTargetAge error = %v, want %v", err, ErrInvalidTargetAgeFormat)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"Project/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDuplicateBarcode = errors.New("duplicate barcode")
+	ErrCopyOnLoan       = errors.New("copy is on loan")
+)
+
+// Copy is a physical copy of a record held by the toy library.
+type Copy struct {
+	ID        int64      `json:"id"`
+	EdtoyID   int64      `json:"edtoy_id"`
+	Barcode   string     `json:"barcode"`
+	Notes     string     `json:"notes,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	OnLoan    bool       `json:"on_loan"`
+	DueAt     *time.Time `json:"due_at,omitempty"`
+}
+
+func ValidateCopy(v *validator.Validator, c *Copy) {
+	v.Check(c.Barcode != "", "barcode", "must be provided")
+	v.Check(len(c.Barcode) <= 64, "barcode", "must not be more than 64 bytes long")
+	v.Check(len(c.Notes) <= 500, "notes", "must not be more than 500 bytes long")
+}
+
+type CopyModel struct {
+	DB *sql.DB
+}
+
+func (m CopyModel) Insert(c *Copy) error {
+	query := `
+INSERT INTO edtoys_copies (edtoy_id, barcode, notes)
+VALUES ($1, $2, $3)
+RETURNING id, created_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, c.EdtoyID, c.Barcode, c.Notes).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "edtoys_copies_barcode_key"`:
+			return ErrDuplicateBarcode
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllForEdtoy() returns the copies of a record still in circulation, along with
+// when each copy on loan is due back.
+func (m CopyModel) GetAllForEdtoy(edtoyID int64) ([]*Copy, error) {
+	query := `
+SELECT edtoys_copies.id, edtoys_copies.edtoy_id, edtoys_copies.barcode, edtoys_copies.notes,
+	edtoys_copies.created_at, loans.id IS NOT NULL, loans.due_at
+FROM edtoys_copies
+LEFT JOIN loans ON loans.copy_id = edtoys_copies.id AND loans.returned_at IS NULL
+WHERE edtoys_copies.edtoy_id = $1 AND edtoys_copies.retired_at IS NULL
+ORDER BY edtoys_copies.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, edtoyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	copies := []*Copy{}
+	for rows.Next() {
+		var c Copy
+		err := rows.Scan(&c.ID, &c.EdtoyID, &c.Barcode, &c.Notes, &c.CreatedAt, &c.OnLoan, &c.DueAt)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+// Retire() takes a copy out of circulation. The row is kept so that past loans still
+// point at something; a copy that's currently on loan can't be retired.
+func (m CopyModel) Retire(edtoyID, copyID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var onLoan bool
+	query := `
+SELECT EXISTS (SELECT 1 FROM loans WHERE loans.copy_id = edtoys_copies.id AND loans.returned_at IS NULL)
+FROM edtoys_copies
+WHERE id = $1 AND edtoy_id = $2 AND retired_at IS NULL
+FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, copyID, edtoyID).Scan(&onLoan)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	if onLoan {
+		return ErrCopyOnLoan
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE edtoys_copies SET retired_at = now() WHERE id = $1`, copyID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -7,33 +7,183 @@ import (
 	"errors"
 	"fmt"
 	"github.com/lib/pq"
+	"strconv"
 	"time"
 )
 
 type Edtoys struct {
-	ID         int64     `json:"id"`
-	CreatedAt  time.Time `json:"-"`
-	Title      string    `json:"title"`
-	Year       int32     `json:"year,omitempty"`
-	TargetAge  string    `json:"target_age"`
-	Genres     []string  `json:"genres,omitempty"`
-	SkillFocus []string  `json:"skill_focus"`
-	Runtime    Runtime   `json:"runtime,omitempty"`
-	Version    int32     `json:"version"`
-}
-
-func ValidateEdtoys(v *validator.Validator, edtoys *Edtoys) {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Title     string    `json:"title"`
+	// Description is free text about the toy. Like Title it is stored in DefaultLocale,
+	// and may be swapped for a translation by TranslationModel.Localize().
+	Description string `json:"description"`
+	Year        int32  `json:"year,omitempty"`
+	// TargetAge is a human-readable rendering of the age range, generated by the
+	// database from MinAgeMonths and MaxAgeMonths. A nil MaxAgeMonths means the range
+	// has no upper bound.
+	TargetAge    string   `json:"target_age"`
+	MinAgeMonths int32    `json:"min_age_months"`
+	MaxAgeMonths *int32   `json:"max_age_months"`
+	Genres       []string `json:"genres,omitempty"`
+	SkillFocus   []string `json:"skill_focus"`
+	Runtime      Runtime  `json:"runtime,omitempty"`
+	Version      int32    `json:"version"`
+	// AverageRating and ReviewCount summarise the record's reviews. They are kept up to
+	// date by ReviewModel.
+	AverageRating float64 `json:"average_rating"`
+	ReviewCount   int     `json:"review_count"`
+	// Media is filled in by the API layer when responding with a record.
+	Media []*Media `json:"media,omitempty"`
+	// Availability is filled in by the API layer on list responses. It isn't part of
+	// the record's version, so it's left off responses that carry an ETag.
+	Availability *Availability `json:"availability,omitempty"`
+	// DeletedAt is only set on records that have been moved to the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Rank and Headline are only populated when the listing is filtered with a
+	// full-text search term.
+	Rank     float32 `json:"rank,omitempty"`
+	Headline string  `json:"headline,omitempty"`
+	// Similarity is only populated on records returned by Similar().
+	Similarity float64 `json:"similarity,omitempty"`
+	// Locale is the language the title and description are in. It is empty until the
+	// record has been through TranslationModel.Localize().
+	Locale string `json:"-"`
+}
+
+// The search document covers the title, skill focus, genres and description, weighted
+// in that order. It is wrapped in the IMMUTABLE edtoys_search_vector() SQL function (see
+// migrations 000009 and 000018) so that the same expression can back a GIN index.
+// Translations carry their own search_vector column, built with the text search
+// configuration of their locale, and a record matches if either the base record or
+// its translation into the search locale ($14) does.
+const (
+	edtoysSearchVector      = `edtoys_search_vector(title, description, skill_focus, genres)`
+	edtoysSearchQuery       = `websearch_to_tsquery('english', $12)`
+	edtoysTranslationQuery  = `websearch_to_tsquery(locale_search_config($14), $12)`
+	edtoysTranslationFilter = `FROM edtoys_translations t WHERE t.edtoy_id = edtoys.id AND t.locale = $14`
+	edtoysSearchRank        = `greatest(ts_rank(` + edtoysSearchVector + `, ` + edtoysSearchQuery + `),
+		coalesce((SELECT ts_rank(t.search_vector, ` + edtoysTranslationQuery + `) ` + edtoysTranslationFilter + `), 0))`
+)
+
+// maxDescriptionLength caps the description of a record and of its translations.
+const maxDescriptionLength = 5000
+
+// ValidateEdtoys() checks a record before it is saved. Genres and skill focus must be
+// slugs of known taxonomy terms, so callers should run the record through
+// Taxonomy.Canonicalize() first to accept names and synonyms too.
+func ValidateEdtoys(v *validator.Validator, edtoys *Edtoys, taxonomy *Taxonomy) {
 	v.Check(edtoys.Title != "", "title", "must be provided")
 	v.Check(len(edtoys.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(edtoys.Description) <= maxDescriptionLength, "description", fmt.Sprintf("must not be more than %d bytes long", maxDescriptionLength))
 	v.Check(edtoys.Year != 0, "year", "must be provided")
 	v.Check(edtoys.Year >= 1888, "year", "must be greater than 1888")
 	v.Check(edtoys.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+	v.Check(edtoys.MinAgeMonths >= 0, "min_age_months", "must not be negative")
+	v.Check(edtoys.MinAgeMonths <= maxAgeMonths, "min_age_months", fmt.Sprintf("must not be more than %d", maxAgeMonths))
+	if edtoys.MaxAgeMonths != nil {
+		v.Check(*edtoys.MaxAgeMonths >= edtoys.MinAgeMonths, "max_age_months", "must not be less than min_age_months")
+		v.Check(*edtoys.MaxAgeMonths <= maxAgeMonths, "max_age_months", fmt.Sprintf("must not be more than %d", maxAgeMonths))
+	}
 	v.Check(edtoys.Runtime != 0, "runtime", "must be provided")
 	v.Check(edtoys.Runtime > 0, "runtime", "must be a positive integer")
 	v.Check(edtoys.Genres != nil, "genres", "must be provided")
 	v.Check(len(edtoys.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(edtoys.Genres) <= 5, "genres", "must not contain more than 5 genres")
 	v.Check(validator.Unique(edtoys.Genres), "genres", "must not contain duplicate values")
+	if genre, ok := taxonomy.unknown(TermKindGenre, edtoys.Genres); ok {
+		v.AddError("genres", fmt.Sprintf("contains an unknown genre: %s", genre))
+	}
+	if skill, ok := taxonomy.unknown(TermKindSkill, edtoys.SkillFocus); ok {
+		v.AddError("skill_focus", fmt.Sprintf("contains an unknown skill: %s", skill))
+	}
+}
+
+// EdtoysCriteria holds the optional conditions that the list endpoint can narrow the
+// catalog down with. Zero values (and nil times) mean "don't filter on this".
+type EdtoysCriteria struct {
+	Title           string
+	Search          string
+	Genres          []string
+	YearMin         int
+	YearMax         int
+	RuntimeMin      int
+	RuntimeMax      int
+	TargetAge       string
+	AgeMonths       *int
+	SkillFocus      []string
+	SkillFocusMatch string
+	CreatedAfter    *time.Time
+	CreatedBefore   *time.Time
+	// SearchLocale is the locale whose translations Search is also matched against,
+	// using that locale's text search configuration.
+	SearchLocale string
+}
+
+func ValidateEdtoysCriteria(v *validator.Validator, c EdtoysCriteria) {
+	v.Check(c.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(c.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(c.YearMax == 0 || c.YearMin <= c.YearMax, "year_min", "must not be greater than year_max")
+	v.Check(c.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(c.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(c.RuntimeMax == 0 || c.RuntimeMin <= c.RuntimeMax, "runtime_min", "must not be greater than runtime_max")
+	v.Check(len(c.Search) <= 500, "q", "must not be more than 500 bytes long")
+	v.Check(len(c.TargetAge) <= 20, "target_age", "must not be more than 20 bytes long")
+	if c.TargetAge != "" {
+		_, _, err := ParseTargetAge(c.TargetAge)
+		v.Check(err == nil, "target_age", "must be in a format like 3+, 4-6 years or 18-36 months")
+	}
+	v.Check(c.AgeMonths == nil || *c.AgeMonths >= 0, "age", "must not be negative")
+	v.Check(validator.In(c.SkillFocusMatch, "any", "all"), "skill_focus_match", "must be either any or all")
+	v.Check(c.CreatedAfter == nil || c.CreatedBefore == nil || c.CreatedAfter.Before(*c.CreatedBefore),
+		"created_after", "must be earlier than created_before")
+}
+
+// where() returns the SQL condition that applies the criteria, along with its
+// placeholder arguments. Every condition is written so that its zero value matches all
+// rows, which keeps the placeholder numbering fixed: callers may append their own
+// arguments from $16 onwards. TargetAge is matched as the age range it describes, so
+// "3+" finds the same records as "3+ years" or "36m+"; it must already have been
+// validated by ValidateEdtoysCriteria().
+func (c EdtoysCriteria) where() (string, []interface{}) {
+	condition := fmt.Sprintf(`(to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (%s @@ %s OR $12 = '' OR EXISTS (SELECT 1 %s AND t.search_vector @@ %s))
+		AND (genres @> $2 or $2 = '{}')
+		AND (year >= $3 OR $3 = 0)
+		AND (year <= $4 OR $4 = 0)
+		AND (runtime >= $5 OR $5 = 0)
+		AND (runtime <= $6 OR $6 = 0)
+		AND ((min_age_months = $7 AND max_age_months IS NOT DISTINCT FROM $15::integer) OR $7::integer IS NULL)
+		AND (skill_focus && $8 OR $8 = '{}' OR $9 = 'all')
+		AND (skill_focus @> $8 OR $9 = 'any')
+		AND (created_at >= $10 OR $10 IS NULL)
+		AND (created_at < $11 OR $11 IS NULL)
+		AND (min_age_months <= $13 OR $13 IS NULL)
+		AND (max_age_months >= $13 OR max_age_months IS NULL OR $13 IS NULL)
+		AND deleted_at IS NULL`, edtoysSearchVector, edtoysSearchQuery, edtoysTranslationFilter, edtoysTranslationQuery)
+	var ageMin, ageMax *int32
+	if c.TargetAge != "" {
+		min, max, _ := ParseTargetAge(c.TargetAge)
+		ageMin, ageMax = &min, max
+	}
+	args := []interface{}{
+		c.Title,
+		pq.Array(c.Genres),
+		c.YearMin,
+		c.YearMax,
+		c.RuntimeMin,
+		c.RuntimeMax,
+		ageMin,
+		pq.Array(c.SkillFocus),
+		c.SkillFocusMatch,
+		c.CreatedAfter,
+		c.CreatedBefore,
+		c.Search,
+		c.AgeMonths,
+		c.SearchLocale,
+		ageMax,
+	}
+	return condition, args
 }
 
 type EdtoysModel struct {
@@ -43,30 +193,97 @@ type EdtoysModel struct {
 func (m EdtoysModel) Insert(edtoys *Edtoys) error {
 
 	query := `
-		INSERT INTO edToys (title, year, target_age, genres, skill_focus, runtime)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, version
+		INSERT INTO edToys (title, description, year, min_age_months, max_age_months, genres, skill_focus, runtime)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, target_age, version
 		`
 
-	args := []interface{}{edtoys.Title, edtoys.Year, edtoys.TargetAge, pq.Array(edtoys.Genres), pq.Array(edtoys.SkillFocus), edtoys.Runtime}
+	args := []interface{}{edtoys.Title, edtoys.Description, edtoys.Year, edtoys.MinAgeMonths, edtoys.MaxAgeMonths, pq.Array(edtoys.Genres), pq.Array(edtoys.SkillFocus), edtoys.Runtime}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&edtoys.ID, &edtoys.CreatedAt, &edtoys.Version)
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&edtoys.ID, &edtoys.CreatedAt, &edtoys.TargetAge, &edtoys.Version)
 
 }
 
+// InsertMany() inserts a batch of records inside a single transaction. Rows that the
+// database rejects (constraint violations and the like) are reported in the returned
+// map, keyed by their index in the slice. By default the first such row rolls the whole
+// batch back, and is the only one reported. When skipFailed is true each row gets its
+// own savepoint instead, so a rejected row is undone on its own while the rest of the
+// batch is still committed.
+func (m EdtoysModel) InsertMany(edtoys []*Edtoys, skipFailed bool) (map[int]error, error) {
+	query := `
+		INSERT INTO edToys (title, description, year, min_age_months, max_age_months, genres, skill_focus, runtime)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, target_age, version`
+
+	// Large imports get a more generous timeout than single-row queries.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	failed := make(map[int]error)
+	for i, e := range edtoys {
+		if skipFailed {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT import_row"); err != nil {
+				return nil, err
+			}
+		}
+		args := []interface{}{e.Title, e.Description, e.Year, e.MinAgeMonths, e.MaxAgeMonths, pq.Array(e.Genres), pq.Array(e.SkillFocus), e.Runtime}
+		err := stmt.QueryRowContext(ctx, args...).Scan(&e.ID, &e.CreatedAt, &e.TargetAge, &e.Version)
+		if err == nil {
+			if skipFailed {
+				_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT import_row")
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		// Only database-side rejections are reported against the row; anything else,
+		// such as a timeout, aborts the import.
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) {
+			return nil, err
+		}
+		failed[i] = errors.New(pqErr.Message)
+		if !skipFailed {
+			return failed, nil
+		}
+		_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_row")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return failed, tx.Commit()
+}
+
 // Add a placeholder method for fetching a specific record from the Edtoyss table.
-func (m EdtoysModel) Get(id int64) (*Edtoys, error) {
+func (m EdtoysModel) Get(id int64, fields ...string) (*Edtoys, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
-		SELECT id, created_at, title, year, target_age,genres, skill_focus,runtime, version
+	// When fields are given, only those columns are read; see edtoysSelect().
+	columns, dest := edtoysSelect(fields)
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM edtoys
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`, columns)
 	// Declare a Movie struct to hold the data returned by the query.
 	var edToy Edtoys
 
@@ -74,19 +291,9 @@ func (m EdtoysModel) Get(id int64) (*Edtoys, error) {
 	defer cancel()
 	// Execute the query using the QueryRow() method, passing in the provided id value
 	// as a placeholder parameter, and scan the response data into the fields of the
-	// Movie struct. Importantly, notice that we need to convert the scan target for the
-	// genres column using the pq.Array() adapter function again.
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&edToy.ID,
-		&edToy.CreatedAt,
-		&edToy.Title,
-		&edToy.Year,
-		&edToy.TargetAge,
-		pq.Array(&edToy.Genres),
-		pq.Array(&edToy.SkillFocus),
-		&edToy.Runtime,
-		&edToy.Version,
-	)
+	// Movie struct. The destinations (including the pq.Array() adapters for the array
+	// columns) come from edtoysSelect() so that they line up with the selected columns.
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(dest(&edToy)...)
 
 	if err != nil {
 		switch {
@@ -100,30 +307,71 @@ func (m EdtoysModel) Get(id int64) (*Edtoys, error) {
 	return &edToy, nil
 }
 
-// Add a placeholder method for updating a specific record in the Edtoyss table.
-func (m EdtoysModel) Update(edtoys *Edtoys) error {
+// Update() saves the changes to a record, using the version number to guard against
+// concurrent edits. The values being replaced are kept as a revision attributed to the
+// given user, in the same transaction as the update itself.
+func (m EdtoysModel) Update(edtoys *Edtoys, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the row as it currently stands so that we can record what it looked like
+	// before this update. If the version has already moved on, that's an edit conflict.
 	query := `
+SELECT id, created_at, title, description, year, target_age, min_age_months, max_age_months, genres, skill_focus, runtime, version
+FROM edtoys
+WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+FOR UPDATE`
+	var previous Edtoys
+	err = tx.QueryRowContext(ctx, query, edtoys.ID, edtoys.Version).Scan(
+		&previous.ID,
+		&previous.CreatedAt,
+		&previous.Title,
+		&previous.Description,
+		&previous.Year,
+		&previous.TargetAge,
+		&previous.MinAgeMonths,
+		&previous.MaxAgeMonths,
+		pq.Array(&previous.Genres),
+		pq.Array(&previous.SkillFocus),
+		&previous.Runtime,
+		&previous.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
 UPDATE edtoys
-SET title = $1, year = $2, target_age = $3, genres = $4, skill_focus = $5, runtime = $6, version = version + 1
-WHERE id = $7 AND version = $8
-RETURNING version`
+SET title = $1, description = $2, year = $3, min_age_months = $4, max_age_months = $5, genres = $6, skill_focus = $7, runtime = $8, version = version + 1
+WHERE id = $9 AND version = $10 AND deleted_at IS NULL
+RETURNING target_age, version`
 	// Create an args slice containing the values for the placeholder parameters.
 	args := []interface{}{
 		edtoys.Title,
+		edtoys.Description,
 		edtoys.Year,
-		edtoys.TargetAge,
+		edtoys.MinAgeMonths,
+		edtoys.MaxAgeMonths,
 		pq.Array(edtoys.Genres),
 		pq.Array(edtoys.SkillFocus),
 		edtoys.Runtime,
 		edtoys.ID,
 		edtoys.Version,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// Use the QueryRow() method to execute the query, passing in the args slice as a
 	// variadic parameter and scanning the new version value into the movie struct.
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&edtoys.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&edtoys.TargetAge, &edtoys.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -132,18 +380,27 @@ RETURNING version`
 			return err
 		}
 	}
-	return nil
+
+	err = insertRevision(ctx, tx, &previous, edtoys, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Add a placeholder method for deleting a specific record from the Edtoyss table.
-func (m EdtoysModel) Delete(id int64) error {
+// Delete() moves a record to the trash by stamping its deleted_at column. The row itself
+// stays in the table until Purge() removes it, so it can still be restored. If version
+// is non-zero the record is only deleted while it is still at that version, and
+// ErrEditConflict is returned otherwise.
+func (m EdtoysModel) Delete(id int64, version int32) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 	// Construct the SQL query to delete the record.
 	query := `
-DELETE FROM edtoys
-WHERE id = $1`
+UPDATE edtoys
+SET deleted_at = now(), version = version + 1
+WHERE id = $1 AND (version = $2 OR $2 = 0) AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -151,7 +408,7 @@ WHERE id = $1`
 	// Execute the SQL query using the Exec() method, passing in the id variable as
 	// the value for the placeholder parameter. The Exec() method returns a sql.Result
 	// object.
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
 		return err
 	}
@@ -164,6 +421,9 @@ WHERE id = $1`
 	// If no rows were affected, we know that the movies table didn't contain a record
 	// with the provided ID at the moment we tried to delete it. In that case we
 	// return an ErrRecordNotFound error.
+	if rowsAffected == 0 && version != 0 {
+		return ErrEditConflict
+	}
 	if rowsAffected == 0 {
 		return ErrRecordNotFound
 	}
@@ -171,21 +431,63 @@ WHERE id = $1`
 
 }
 
-func (m EdtoysModel) GetAll(title string, genres []string, filters Filters) ([]*Edtoys, Metadata, error) {
+// GetAll() returns a page of the records matching the criteria. When fields are given,
+// only those columns are read, plus whatever the sort needs for building cursors.
+func (m EdtoysModel) GetAll(criteria EdtoysCriteria, filters Filters, fields ...string) ([]*Edtoys, Metadata, error) {
+	where, args := criteria.where()
+	columns, dest := edtoysSelect(fields, filters.sortField())
+	column := edtoysSortExpression(filters)
+	// In page mode we keep the window count and the LIMIT/OFFSET pair. In cursor mode we
+	// skip both and instead seek past the row the cursor points at, which stays stable
+	// when records are added or removed while a client is walking the catalog.
+	var c cursor
+	keyset := filters.Cursor != ""
+	total := "count(*) OVER()"
+	seek := ""
+	orderBy := fmt.Sprintf("%s %s, id ASC", column, filters.sortDirection())
+	limit := fmt.Sprintf("LIMIT %d OFFSET %d", filters.limit(), filters.offset())
+	if keyset {
+		var err error
+		c, err = decodeCursor(filters.Cursor)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		args = append(args, c.Value, c.ID)
+		value, id := len(args)-1, len(args)
+		idOperator, orderDirection, idDirection := ">", filters.sortDirection(), "ASC"
+		if c.Backward {
+			idOperator, idDirection = "<", "DESC"
+			orderDirection = map[string]string{"ASC": "DESC", "DESC": "ASC"}[orderDirection]
+		}
+		total = "0"
+		seek = fmt.Sprintf("AND (%[1]s %[2]s $%[4]d OR (%[1]s = $%[4]d AND id %[3]s $%[5]d))",
+			column, filters.cursorOperator(c.Backward), idOperator, value, id)
+		orderBy = fmt.Sprintf("%s %s, id %s", column, orderDirection, idDirection)
+		// Fetch one extra row so we know whether another page follows.
+		limit = fmt.Sprintf("LIMIT %d", filters.limit()+1)
+	}
 	// Construct the SQL query to retrieve all movie records.
 	query := fmt.Sprintf(`
-		SELECT  count(*) OVER(), id, created_at, title, year, target_age, genres, skill_focus, runtime, version
+		SELECT  %[1]s, %[8]s,
+			CASE WHEN $12 = '' THEN 0 ELSE %[5]s END,
+			CASE WHEN $12 = '' THEN '' ELSE coalesce(
+				(SELECT ts_headline(locale_search_config(t.locale), t.title || ' ' || t.description,
+					%[10]s, 'MaxFragments=2, MaxWords=20, MinWords=5')
+				%[9]s AND t.search_vector @@ %[10]s),
+				ts_headline('english',
+					title || ' ' || array_to_string(skill_focus, ', ') || ' ' || array_to_string(genres, ', ') || ' ' || description,
+					%[7]s, 'MaxFragments=2, MaxWords=20, MinWords=5')) END
 		FROM edtoys
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (genres @> $2 or $2 = '{}')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		WHERE %[6]s
+		%[2]s
+		ORDER BY %[3]s
+		%[4]s`, total, seek, orderBy, limit, edtoysSearchRank, where, edtoysSearchQuery, columns,
+		edtoysTranslationFilter, edtoysTranslationQuery)
 	// Create a context with a 3-second timeout.
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	// Use QueryContext() to execute the query. This returns a sql.Rows resultset
 	// containing the result.
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -200,33 +502,304 @@ func (m EdtoysModel) GetAll(title string, genres []string, filters Filters) ([]*
 	for rows.Next() {
 		// Initialize an empty Movie struct to hold the data for an individual movie.
 		var edtoys Edtoys
-		// Scan the values from the row into the Movie struct. Again, note that we're
-		// using the pq.Array() adapter on the genres field here.
+		// Scan the values from the row into the Movie struct, bracketed by the window
+		// count and the search rank and headline.
+		targets := append([]interface{}{&totalRecords}, dest(&edtoys)...)
+		err := rows.Scan(append(targets, &edtoys.Rank, &edtoys.Headline)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		// Add the Movie struct to the slice.
+		edToys = append(edToys, &edtoys)
+	}
+	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error
+	// that was encountered during the iteration.
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if !keyset {
+		metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+		// Hand out cursors from page mode too, so a client can start with ?page=1 and
+		// then switch over to cursors.
+		if len(edToys) > 0 && filters.Page < metadata.LastPage {
+			metadata.NextCursor = edtoysCursor(edToys[len(edToys)-1], filters, false)
+		}
+		if len(edToys) > 0 && filters.Page > 1 {
+			metadata.PrevCursor = edtoysCursor(edToys[0], filters, true)
+		}
+		// If everything went OK, then return the slice of movies.
+		return edToys, metadata, nil
+	}
+
+	more := len(edToys) > filters.limit()
+	if more {
+		edToys = edToys[:filters.limit()]
+	}
+	// A backward page was read in reverse order, so flip it back around.
+	if c.Backward {
+		for i, j := 0, len(edToys)-1; i < j; i, j = i+1, j-1 {
+			edToys[i], edToys[j] = edToys[j], edToys[i]
+		}
+	}
+	metadata := Metadata{PageSize: filters.PageSize}
+	if len(edToys) > 0 {
+		if more || c.Backward {
+			metadata.NextCursor = edtoysCursor(edToys[len(edToys)-1], filters, false)
+		}
+		if more || !c.Backward {
+			metadata.PrevCursor = edtoysCursor(edToys[0], filters, true)
+		}
+	}
+	return edToys, metadata, nil
+}
+
+// edtoysSortExpression() returns the SQL expression to sort and seek on for the active
+// sort. Most sort values name a column directly, but relevance is computed from the
+// search query (against the base record or its translation, whichever ranks higher)
+// and rating is stored as average_rating.
+func edtoysSortExpression(filters Filters) string {
+	switch column := filters.sortColumn(); column {
+	case "relevance":
+		return edtoysSearchRank
+	case "rating":
+		return "average_rating"
+	default:
+		return column
+	}
+}
+
+// edtoysCursor() builds a cursor pointing at the given record for the active sort.
+func edtoysCursor(edtoys *Edtoys, filters Filters, backward bool) string {
+	var value string
+	switch filters.sortColumn() {
+	case "title":
+		value = edtoys.Title
+	case "year":
+		value = strconv.FormatInt(int64(edtoys.Year), 10)
+	case "runtime":
+		value = strconv.FormatInt(int64(edtoys.Runtime), 10)
+	case "relevance":
+		value = strconv.FormatFloat(float64(edtoys.Rank), 'g', -1, 32)
+	case "rating":
+		value = strconv.FormatFloat(edtoys.AverageRating, 'f', -1, 64)
+	default:
+		value = strconv.FormatInt(edtoys.ID, 10)
+	}
+	return encodeCursor(cursor{Sort: filters.Sort, Value: value, ID: edtoys.ID, Backward: backward})
+}
+
+// Export() streams every record matching the criteria, in the order given by filters,
+// to fn one row at a time. Unlike GetAll() nothing is paginated or held in memory, so
+// it is suitable for dumping the whole catalog. The query runs for as long as ctx
+// allows, and stops early if fn returns an error.
+func (m EdtoysModel) Export(ctx context.Context, criteria EdtoysCriteria, filters Filters, fn func(*Edtoys) error) error {
+	where, args := criteria.where()
+	column := edtoysSortExpression(filters)
+	query := fmt.Sprintf(`
+		SELECT id, created_at, title, description, year, target_age, min_age_months, max_age_months, genres, skill_focus, runtime, version, average_rating, review_count
+		FROM edtoys
+		WHERE %s
+		ORDER BY %s %s, id ASC`, where, column, filters.sortDirection())
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var edtoys Edtoys
+		err := rows.Scan(
+			&edtoys.ID,
+			&edtoys.CreatedAt,
+			&edtoys.Title,
+			&edtoys.Description,
+			&edtoys.Year,
+			&edtoys.TargetAge,
+			&edtoys.MinAgeMonths,
+			&edtoys.MaxAgeMonths,
+			pq.Array(&edtoys.Genres),
+			pq.Array(&edtoys.SkillFocus),
+			&edtoys.Runtime,
+			&edtoys.Version,
+			&edtoys.AverageRating,
+			&edtoys.ReviewCount,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(&edtoys); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Restore() takes a record back out of the trash.
+func (m EdtoysModel) Restore(id int64) (*Edtoys, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+UPDATE edtoys
+SET deleted_at = NULL, version = version + 1
+WHERE id = $1 AND deleted_at IS NOT NULL
+RETURNING id, created_at, title, description, year, target_age, min_age_months, max_age_months, genres, skill_focus, runtime, version, average_rating, review_count`
+
+	var edtoys Edtoys
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&edtoys.ID,
+		&edtoys.CreatedAt,
+		&edtoys.Title,
+		&edtoys.Description,
+		&edtoys.Year,
+		&edtoys.TargetAge,
+		&edtoys.MinAgeMonths,
+		&edtoys.MaxAgeMonths,
+		pq.Array(&edtoys.Genres),
+		pq.Array(&edtoys.SkillFocus),
+		&edtoys.Runtime,
+		&edtoys.Version,
+		&edtoys.AverageRating,
+		&edtoys.ReviewCount,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &edtoys, nil
+}
+
+// GetAllDeleted() lists the records currently in the trash.
+func (m EdtoysModel) GetAllDeleted(filters Filters) ([]*Edtoys, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, title, description, year, target_age, min_age_months, max_age_months, genres, skill_focus, runtime, version, average_rating, review_count, deleted_at
+		FROM edtoys
+		WHERE deleted_at IS NOT NULL
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	edToys := []*Edtoys{}
+	for rows.Next() {
+		var edtoys Edtoys
 		err := rows.Scan(
 			&totalRecords,
 			&edtoys.ID,
 			&edtoys.CreatedAt,
 			&edtoys.Title,
+			&edtoys.Description,
 			&edtoys.Year,
 			&edtoys.TargetAge,
+			&edtoys.MinAgeMonths,
+			&edtoys.MaxAgeMonths,
 			pq.Array(&edtoys.Genres),
 			pq.Array(&edtoys.SkillFocus),
 			&edtoys.Runtime,
 			&edtoys.Version,
+			&edtoys.AverageRating,
+			&edtoys.ReviewCount,
+			&edtoys.DeletedAt,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		// Add the Movie struct to the slice.
 		edToys = append(edToys, &edtoys)
 	}
-	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error
-	// that was encountered during the iteration.
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
-
-	// If everything went OK, then return the slice of movies.
 	return edToys, metadata, nil
 }
+
+// Purge() permanently deletes records which have been in the trash for longer than the
+// retention period. It returns how many were removed, along with their media, whose
+// stored files the caller is responsible for deleting once the rows are gone.
+func (m EdtoysModel) Purge(retention time.Duration) (int64, []*Media, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the records first, so that one restored in the meantime keeps its media.
+	query := `
+SELECT id
+FROM edtoys
+WHERE deleted_at IS NOT NULL AND deleted_at < $1
+FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	if len(ids) == 0 {
+		return 0, nil, nil
+	}
+
+	query = `
+DELETE FROM edtoys_media
+WHERE edtoy_id = ANY($1)
+RETURNING id, edtoy_id, key, thumbnail_key`
+	rows, err = tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, nil, err
+	}
+	var media []*Media
+	for rows.Next() {
+		var item Media
+		if err := rows.Scan(&item.ID, &item.EdtoyID, &item.Key, &item.ThumbnailKey); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		media = append(media, &item)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM edtoys WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, nil, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, nil, err
+	}
+	return removed, media, tx.Commit()
+}
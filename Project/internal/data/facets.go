@@ -0,0 +1,84 @@
+package data
+
+import (
+	"Project/internal/validator"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FacetSafelist holds the fields that facet counts can be requested for.
+var FacetSafelist = []string{"genres", "skill_focus", "year"}
+
+// FacetCount is the number of matching records that have a particular value.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// The SQL that produces the (value, count) rows for each facet. The array columns are
+// unnested so that every genre or skill of a record is counted separately.
+var facetQueries = map[string]string{
+	"genres":      `SELECT 'genres', value, count(*) FROM matches, unnest(genres) AS value GROUP BY value`,
+	"skill_focus": `SELECT 'skill_focus', value, count(*) FROM matches, unnest(skill_focus) AS value GROUP BY value`,
+	"year":        `SELECT 'year', year::text, count(*) FROM matches GROUP BY year`,
+}
+
+// Facets() counts the records matching the criteria by each value of the named
+// fields. The counts cover every matching record rather than a single page. Values are
+// ordered by descending count, except for year which is ordered chronologically.
+func (m EdtoysModel) Facets(criteria EdtoysCriteria, names []string) (map[string][]FacetCount, error) {
+	facets := make(map[string][]FacetCount)
+	if len(names) == 0 {
+		return facets, nil
+	}
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		part, ok := facetQueries[name]
+		if !ok {
+			panic("unsafe facet parameter: " + name)
+		}
+		parts = append(parts, part)
+		facets[name] = []FacetCount{}
+	}
+
+	where, args := criteria.where()
+	query := fmt.Sprintf(`
+		WITH matches AS (
+			SELECT genres, skill_focus, year
+			FROM edtoys
+			WHERE %s
+		)
+		SELECT * FROM (%s) AS facets (facet, value, count)
+		ORDER BY facet, CASE WHEN facet = 'year' THEN 0 ELSE count END DESC, value`,
+		where, strings.Join(parts, " UNION ALL "))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var count FacetCount
+		err := rows.Scan(&name, &count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		facets[name] = append(facets[name], count)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
+
+func ValidateFacets(v *validator.Validator, names []string) {
+	for _, name := range names {
+		v.Check(validator.In(name, FacetSafelist...), "facets", "invalid facet value")
+	}
+	v.Check(validator.Unique(names), "facets", "must not contain duplicate values")
+}
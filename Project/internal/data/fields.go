@@ -0,0 +1,80 @@
+package data
+
+import (
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// edtoysColumns lists the stored fields of a record in the order they're selected, with
+// the JSON name clients use for each and where its value is scanned to.
+var edtoysColumns = []struct {
+	field  string
+	column string
+	dest   func(*Edtoys) interface{}
+}{
+	{"id", "id", func(e *Edtoys) interface{} { return &e.ID }},
+	{"title", "title", func(e *Edtoys) interface{} { return &e.Title }},
+	{"description", "description", func(e *Edtoys) interface{} { return &e.Description }},
+	{"year", "year", func(e *Edtoys) interface{} { return &e.Year }},
+	{"target_age", "target_age", func(e *Edtoys) interface{} { return &e.TargetAge }},
+	{"min_age_months", "min_age_months", func(e *Edtoys) interface{} { return &e.MinAgeMonths }},
+	{"max_age_months", "max_age_months", func(e *Edtoys) interface{} { return &e.MaxAgeMonths }},
+	{"genres", "genres", func(e *Edtoys) interface{} { return pq.Array(&e.Genres) }},
+	{"skill_focus", "skill_focus", func(e *Edtoys) interface{} { return pq.Array(&e.SkillFocus) }},
+	{"runtime", "runtime", func(e *Edtoys) interface{} { return &e.Runtime }},
+	{"version", "version", func(e *Edtoys) interface{} { return &e.Version }},
+	{"average_rating", "average_rating", func(e *Edtoys) interface{} { return &e.AverageRating }},
+	{"review_count", "review_count", func(e *Edtoys) interface{} { return &e.ReviewCount }},
+}
+
+// EdtoysColumnFields() returns the names of the fields that are read from the edtoys
+// table, for use when validating a sparse fieldset.
+func EdtoysColumnFields() []string {
+	fields := make([]string, len(edtoysColumns))
+	for i, c := range edtoysColumns {
+		fields[i] = c.field
+	}
+	return fields
+}
+
+// edtoysSelect() builds the column list for reading a record restricted to the given
+// fields, along with a function returning the matching scan destinations. An empty
+// fields slice selects everything. The fields in required are always selected, since
+// the model needs them for things like cursors and entity tags; id and version are
+// always included for the same reason. Unknown names are ignored.
+func edtoysSelect(fields []string, required ...string) (string, func(*Edtoys) []interface{}) {
+	wanted := make(map[string]bool, len(fields)+len(required)+2)
+	for _, f := range fields {
+		wanted[f] = true
+	}
+	for _, f := range append(required, "id", "version") {
+		wanted[f] = true
+	}
+	var columns []string
+	var dests []func(*Edtoys) interface{}
+	for _, c := range edtoysColumns {
+		if len(fields) == 0 || wanted[c.field] {
+			columns = append(columns, c.column)
+			dests = append(dests, c.dest)
+		}
+	}
+	return strings.Join(columns, ", "), func(e *Edtoys) []interface{} {
+		targets := make([]interface{}, len(dests))
+		for i, dest := range dests {
+			targets[i] = dest(e)
+		}
+		return targets
+	}
+}
+
+// sortField() returns the field a sort value orders by, so that it can be selected for
+// building cursors.
+func (f Filters) sortField() string {
+	switch column := f.sortColumn(); column {
+	case "rating":
+		return "average_rating"
+	default:
+		return column
+	}
+}
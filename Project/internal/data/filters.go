@@ -2,23 +2,67 @@ package data
 
 import (
 	"Project/internal/validator"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"math"
 	"strings"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	Cursor       string
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+}
+
+// The cursor type is the decoded form of the opaque keyset pagination token that we
+// hand out to clients. It records the sort it was generated for, the value of the sort
+// column in the boundary row and that row's id (which acts as the tie-breaker). The
+// Backward flag is set on "previous page" cursors.
+type cursor struct {
+	Sort     string `json:"s"`
+	Value    string `json:"v"`
+	ID       int64  `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// encodeCursor() turns a cursor into the URL-safe string that is returned in the
+// next_cursor and prev_cursor metadata fields.
+func encodeCursor(c cursor) string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		// Marshaling a struct of strings, ints and bools cannot fail.
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// decodeCursor() is the inverse of encodeCursor(). Anything that doesn't decode cleanly
+// is reported as ErrInvalidCursor.
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(js, &c); err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
 }
 
 // The calculateMetadata() function calculates the appropriate pagination metadata
@@ -52,12 +96,22 @@ func (f Filters) sortColumn() string {
 // Return the sort direction ("ASC" or "DESC") depending on the prefix character of the
 // Sort field.
 func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
+	// Relevance only makes sense best match first.
+	if strings.HasPrefix(f.Sort, "-") || f.Sort == "relevance" {
 		return "DESC"
 	}
 	return "ASC"
 }
 
+// Return the comparison operator that selects the rows after the cursor for the current
+// sort direction. For a backward cursor the operator is flipped.
+func (f Filters) cursorOperator(backward bool) string {
+	if (f.sortDirection() == "DESC") != backward {
+		return "<"
+	}
+	return ">"
+}
+
 func (f Filters) limit() int {
 	return f.PageSize
 }
@@ -73,4 +127,10 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 	// Check that the sort parameter matches a value in the safelist.
 	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	// A cursor is only meaningful for the sort it was generated with.
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil, "cursor", "invalid cursor value")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "does not match the sort parameter")
+	}
 }
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"Project/internal/validator"
+	"encoding/base64"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []cursor{
+		{Sort: "id", Value: "1", ID: 1},
+		{Sort: "-title", Value: "Shape Sorter, \"Deluxe\"", ID: 42},
+		{Sort: "year", Value: "2021", ID: 7, Backward: true},
+		{Sort: "-runtime", Value: "", ID: 9_000_000_000},
+	}
+	for _, want := range tests {
+		s := encodeCursor(want)
+		got, err := decodeCursor(s)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q) error = %v", s, err)
+		}
+		if got != want {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v", want, got)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"not JSON", encode("id:1")},
+		{"wrong types", encode(`{"s":"id","v":"1","i":"1"}`)},
+		{"missing id", encode(`{"s":"id","v":"1"}`)},
+		{"negative id", encode(`{"s":"id","v":"1","i":-1}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor); err != ErrInvalidCursor {
+				t.Errorf("decodeCursor error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestValidateFiltersCursor(t *testing.T) {
+	safelist := []string{"id", "title", "-id", "-title"}
+	tests := []struct {
+		name    string
+		sort    string
+		cursor  string
+		wantErr string
+	}{
+		{"no cursor", "title", "", ""},
+		{"matching sort", "title", encodeCursor(cursor{Sort: "title", Value: "a", ID: 1}), ""},
+		{"matching backward cursor", "-id", encodeCursor(cursor{Sort: "-id", Value: "5", ID: 5, Backward: true}), ""},
+		{"other sort", "title", encodeCursor(cursor{Sort: "id", Value: "1", ID: 1}), "does not match the sort parameter"},
+		{"other direction", "-title", encodeCursor(cursor{Sort: "title", Value: "a", ID: 1}), "does not match the sort parameter"},
+		{"malformed", "title", "garbage", "invalid cursor value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateFilters(v, Filters{Page: 1, PageSize: 20, Sort: tt.sort, SortSafelist: safelist, Cursor: tt.cursor})
+			if got := v.Errors["cursor"]; got != tt.wantErr {
+				t.Errorf("cursor error = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCursorOperator(t *testing.T) {
+	safelist := []string{"id", "-id"}
+	tests := []struct {
+		sort     string
+		backward bool
+		want     string
+	}{
+		{"id", false, ">"},
+		{"id", true, "<"},
+		{"-id", false, "<"},
+		{"-id", true, ">"},
+	}
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortSafelist: safelist}
+		if got := f.cursorOperator(tt.backward); got != tt.want {
+			t.Errorf("cursorOperator(%t) with sort %q = %q, want %q", tt.backward, tt.sort, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNoCopyAvailable = errors.New("no copy available")
+	ErrAlreadyBorrowed = errors.New("already borrowed")
+)
+
+type Loan struct {
+	ID           int64      `json:"id"`
+	CopyID       int64      `json:"copy_id"`
+	EdtoyID      int64      `json:"edtoy_id"`
+	Title        string     `json:"title"`
+	UserID       int64      `json:"user_id"`
+	CheckedOutAt time.Time  `json:"checked_out_at"`
+	DueAt        time.Time  `json:"due_at"`
+	ReturnedAt   *time.Time `json:"returned_at,omitempty"`
+	Overdue      bool       `json:"overdue"`
+}
+
+// Availability summarises a record's copies for the list and show responses.
+type Availability struct {
+	Copies       int `json:"copies"`
+	Available    int `json:"available"`
+	Reservations int `json:"reservations"`
+}
+
+// LoanCriteria narrows down the loans returned by GetAll(). Zero values match
+// everything.
+type LoanCriteria struct {
+	UserID  int64
+	Active  bool
+	Overdue bool
+}
+
+type LoanModel struct {
+	DB *sql.DB
+}
+
+// Checkout() lends a copy of a record to a user for the given period.
+//
+// The record's row is locked for the length of the transaction so that checkouts of
+// the same record happen one at a time; two people can't both take the last copy.
+// When people are queued for the record, the free copies go to the front of the queue
+// first, so a user can only take a copy if there are more free copies than people
+// waiting ahead of them.
+func (m LoanModel) Checkout(edtoyID, userID int64, period time.Duration) (*Loan, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	loan := &Loan{EdtoyID: edtoyID, UserID: userID}
+	query := `
+SELECT title
+FROM edtoys
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, edtoyID).Scan(&loan.Title)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	var borrowed bool
+	query = `
+SELECT EXISTS (
+	SELECT 1
+	FROM loans
+	INNER JOIN edtoys_copies ON edtoys_copies.id = loans.copy_id
+	WHERE edtoys_copies.edtoy_id = $1 AND loans.user_id = $2 AND loans.returned_at IS NULL)`
+	err = tx.QueryRowContext(ctx, query, edtoyID, userID).Scan(&borrowed)
+	if err != nil {
+		return nil, err
+	}
+	if borrowed {
+		return nil, ErrAlreadyBorrowed
+	}
+
+	free, err := queryIDs(ctx, tx, `
+SELECT id
+FROM edtoys_copies
+WHERE edtoy_id = $1 AND retired_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM loans WHERE loans.copy_id = edtoys_copies.id AND loans.returned_at IS NULL)
+ORDER BY id
+FOR UPDATE`, edtoyID)
+	if err != nil {
+		return nil, err
+	}
+	queue, err := queryIDs(ctx, tx, `
+SELECT user_id
+FROM reservations
+WHERE edtoy_id = $1
+ORDER BY created_at, id`, edtoyID)
+	if err != nil {
+		return nil, err
+	}
+	ahead := len(queue)
+	for i, id := range queue {
+		if id == userID {
+			ahead = i
+			break
+		}
+	}
+	if ahead >= len(free) {
+		return nil, ErrNoCopyAvailable
+	}
+
+	loan.CopyID = free[0]
+	query = `
+INSERT INTO loans (copy_id, user_id, due_at)
+VALUES ($1, $2, now() + $3 * interval '1 second')
+RETURNING id, checked_out_at, due_at`
+	err = tx.QueryRowContext(ctx, query, loan.CopyID, userID, int64(period.Seconds())).Scan(&loan.ID, &loan.CheckedOutAt, &loan.DueAt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM reservations WHERE edtoy_id = $1 AND user_id = $2`, edtoyID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return loan, tx.Commit()
+}
+
+// queryIDs() runs a query returning a single bigint column and collects the results.
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Return() marks an outstanding loan as returned.
+func (m LoanModel) Return(loan *Loan) error {
+	query := `
+UPDATE loans
+SET returned_at = now()
+WHERE id = $1 AND returned_at IS NULL
+RETURNING returned_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, loan.ID).Scan(&loan.ReturnedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	loan.Overdue = false
+	return nil
+}
+
+const loanColumns = `loans.id, loans.copy_id, edtoys_copies.edtoy_id, edtoys.title, loans.user_id,
+	loans.checked_out_at, loans.due_at, loans.returned_at,
+	loans.returned_at IS NULL AND loans.due_at < now()`
+
+func (m LoanModel) Get(id int64) (*Loan, error) {
+	query := fmt.Sprintf(`
+SELECT %s
+FROM loans
+INNER JOIN edtoys_copies ON edtoys_copies.id = loans.copy_id
+INNER JOIN edtoys ON edtoys.id = edtoys_copies.edtoy_id
+WHERE loans.id = $1`, loanColumns)
+	var loan Loan
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&loan.ID,
+		&loan.CopyID,
+		&loan.EdtoyID,
+		&loan.Title,
+		&loan.UserID,
+		&loan.CheckedOutAt,
+		&loan.DueAt,
+		&loan.ReturnedAt,
+		&loan.Overdue,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &loan, nil
+}
+
+func (m LoanModel) GetAll(criteria LoanCriteria, filters Filters) ([]*Loan, Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), %s
+FROM loans
+INNER JOIN edtoys_copies ON edtoys_copies.id = loans.copy_id
+INNER JOIN edtoys ON edtoys.id = edtoys_copies.edtoy_id
+WHERE (loans.user_id = $1 OR $1 = 0)
+AND (loans.returned_at IS NULL OR NOT $2)
+AND ((loans.returned_at IS NULL AND loans.due_at < now()) OR NOT $3)
+ORDER BY loans.%s %s, loans.id ASC
+LIMIT $4 OFFSET $5`, loanColumns, filters.sortColumn(), filters.sortDirection())
+	args := []interface{}{criteria.UserID, criteria.Active, criteria.Overdue, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	loans := []*Loan{}
+	for rows.Next() {
+		var loan Loan
+		err := rows.Scan(
+			&totalRecords,
+			&loan.ID,
+			&loan.CopyID,
+			&loan.EdtoyID,
+			&loan.Title,
+			&loan.UserID,
+			&loan.CheckedOutAt,
+			&loan.DueAt,
+			&loan.ReturnedAt,
+			&loan.Overdue,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		loans = append(loans, &loan)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return loans, metadata, nil
+}
+
+// AvailabilityForEdtoys() counts the copies, free copies and queued reservations for
+// each of the given records, keyed by record ID.
+func (m LoanModel) AvailabilityForEdtoys(ids ...int64) (map[int64]*Availability, error) {
+	query := `
+SELECT edtoy.id,
+	(SELECT count(*) FROM edtoys_copies
+		WHERE edtoys_copies.edtoy_id = edtoy.id AND edtoys_copies.retired_at IS NULL),
+	(SELECT count(*) FROM edtoys_copies
+		WHERE edtoys_copies.edtoy_id = edtoy.id AND edtoys_copies.retired_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM loans WHERE loans.copy_id = edtoys_copies.id AND loans.returned_at IS NULL)),
+	(SELECT count(*) FROM reservations WHERE reservations.edtoy_id = edtoy.id)
+FROM unnest($1::bigint[]) AS edtoy(id)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	availability := make(map[int64]*Availability, len(ids))
+	for rows.Next() {
+		var id int64
+		var a Availability
+		err := rows.Scan(&id, &a.Copies, &a.Available, &a.Reservations)
+		if err != nil {
+			return nil, err
+		}
+		availability[id] = &a
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return availability, nil
+}
@@ -0,0 +1,113 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Media is an image attached to an educational toy. The Key fields locate the original
+// and its thumbnail in the blob store; the URL fields are filled in by the API layer,
+// since only it knows where the store is served from.
+type Media struct {
+	ID           int64     `json:"id"`
+	EdtoyID      int64     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Key          string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+}
+
+type MediaModel struct {
+	DB *sql.DB
+}
+
+func (m MediaModel) Insert(media *Media) error {
+	query := `
+INSERT INTO edtoys_media (edtoy_id, content_type, size_bytes, width, height, key, thumbnail_key)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at`
+	args := []interface{}{media.EdtoyID, media.ContentType, media.Size, media.Width, media.Height, media.Key, media.ThumbnailKey}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&media.ID, &media.CreatedAt)
+}
+
+// GetAllForEdtoys() returns the media for several records at once, grouped by record
+// ID, so that a page of results can be decorated with a single query.
+func (m MediaModel) GetAllForEdtoys(edtoyIDs ...int64) (map[int64][]*Media, error) {
+	query := `
+SELECT id, edtoy_id, created_at, content_type, size_bytes, width, height, key, thumbnail_key
+FROM edtoys_media
+WHERE edtoy_id = ANY($1)
+ORDER BY id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(edtoyIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	media := make(map[int64][]*Media)
+	for rows.Next() {
+		var item Media
+		err := rows.Scan(
+			&item.ID,
+			&item.EdtoyID,
+			&item.CreatedAt,
+			&item.ContentType,
+			&item.Size,
+			&item.Width,
+			&item.Height,
+			&item.Key,
+			&item.ThumbnailKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+		media[item.EdtoyID] = append(media[item.EdtoyID], &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// Delete() removes a media record and returns it, so that the caller can clean up the
+// stored files.
+func (m MediaModel) Delete(edtoyID, mediaID int64) (*Media, error) {
+	query := `
+DELETE FROM edtoys_media
+WHERE id = $1 AND edtoy_id = $2
+RETURNING id, edtoy_id, created_at, content_type, size_bytes, width, height, key, thumbnail_key`
+	var media Media
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, mediaID, edtoyID).Scan(
+		&media.ID,
+		&media.EdtoyID,
+		&media.CreatedAt,
+		&media.ContentType,
+		&media.Size,
+		&media.Width,
+		&media.Height,
+		&media.Key,
+		&media.ThumbnailKey,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &media, nil
+}
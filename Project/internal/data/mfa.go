@@ -0,0 +1,309 @@
+package data
+
+import (
+	"Project/internal/totp"
+	"Project/internal/validator"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor authentication code")
+)
+
+// totpSkew is how many time steps either side of the current one a code is accepted
+// from, to allow for the clock on the user's device drifting.
+const totpSkew = 1
+
+// recoveryCodeCount is how many recovery codes a user is given at a time.
+const recoveryCodeCount = 10
+
+var totpCodeRX = regexp.MustCompile(`^[0-9]{6}$`)
+
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(totpCodeRX.MatchString(code), "code", "must be 6 digits")
+}
+
+// ValidateSecondFactor checks a request that proves possession of the second factor
+// with either a TOTP code or a recovery code, but not both.
+func ValidateSecondFactor(v *validator.Validator, code, recoveryCode string) {
+	switch {
+	case code == "" && recoveryCode == "":
+		v.AddError("code", "must be provided")
+	case code != "" && recoveryCode != "":
+		v.AddError("recovery_code", "must not be provided along with code")
+	case code != "":
+		ValidateTOTPCode(v, code)
+	default:
+		v.Check(len(normalizeRecoveryCode(recoveryCode)) == 16, "recovery_code", "must be 16 characters long")
+	}
+}
+
+type MFAModel struct {
+	DB *sql.DB
+}
+
+// Enroll() generates a new TOTP secret for the user and stores it pending
+// confirmation, replacing any earlier enrollment that wasn't confirmed. It returns
+// ErrMFAAlreadyEnabled if the user already has two-factor authentication turned on.
+func (m MFAModel) Enroll(userID int64) ([]byte, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	query := `
+UPDATE users
+SET totp_secret = $1, totp_last_step = 0
+WHERE id = $2 AND NOT totp_enabled`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, secret, userID)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	return secret, nil
+}
+
+// Confirm() turns on two-factor authentication for the user, given a code from the
+// secret handed out by Enroll(), and returns their first set of recovery codes. It
+// returns ErrRecordNotFound if there's no enrollment in progress, ErrMFAAlreadyEnabled
+// if it's already on and ErrInvalidMFACode if the code is wrong.
+func (m MFAModel) Confirm(userID int64, code string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+SELECT totp_secret, totp_enabled, totp_last_step
+FROM users
+WHERE id = $1
+FOR UPDATE`
+	var secret []byte
+	var enabled bool
+	var lastStep int64
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&secret, &enabled, &lastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	switch {
+	case enabled:
+		return nil, ErrMFAAlreadyEnabled
+	case secret == nil:
+		return nil, ErrRecordNotFound
+	}
+	step, ok := totp.Match(secret, code, time.Now(), totpSkew, lastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	query = `
+UPDATE users
+SET totp_enabled = true, totp_last_step = $2, version = version + 1
+WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// Verify() reports whether the code is a valid TOTP code for a user who has two-factor
+// authentication turned on. Each code is accepted at most once.
+func (m MFAModel) Verify(userID int64, code string) (bool, error) {
+	query := `
+SELECT totp_secret, totp_last_step
+FROM users
+WHERE id = $1 AND totp_enabled`
+	var secret []byte
+	var lastStep int64
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&secret, &lastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	step, ok := totp.Match(secret, code, time.Now(), totpSkew, lastStep)
+	if !ok {
+		return false, nil
+	}
+	// Moving totp_last_step forward only if nobody else has in the meantime means two
+	// requests racing with the same code can't both succeed.
+	query = `
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2`
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode() reports whether the code is one of the user's unused recovery
+// codes, marking it as used if so.
+func (m MFAModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	query := `
+UPDATE recovery_codes
+SET used_at = now()
+WHERE hash = $1 AND user_id = $2 AND used_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, hash[:], userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// ReplaceRecoveryCodes() discards the user's recovery codes, used or not, and returns
+// a new set.
+func (m MFAModel) ReplaceRecoveryCodes(userID int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// Disable() turns off two-factor authentication for the user, dropping their secret and
+// recovery codes.
+func (m MFAModel) Disable(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+UPDATE users
+SET totp_secret = NULL, totp_enabled = false, totp_last_step = 0, version = version + 1
+WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetRequired() sets whether the user must use two-factor authentication.
+func (m MFAModel) SetRequired(userID int64, required bool) (*User, error) {
+	query := `
+UPDATE users
+SET mfa_required = $2, version = version + 1
+WHERE id = $1
+RETURNING id, created_at, name, email, activated, totp_enabled, mfa_required, version`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID, required).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		&user.MFAEnabled,
+		&user.MFARequired,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// replaceRecoveryCodes() deletes the user's recovery codes and stores the hashes of a
+// new set, returning their plaintext. The codes are 16 base-32 characters, shown in
+// groups of four to make them easier to copy down.
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64) ([]string, error) {
+	_, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		randomBytes := make([]byte, 10)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, err
+		}
+		plaintext := base32.StdEncoding.EncodeToString(randomBytes)
+		hash := sha256.Sum256([]byte(plaintext))
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (hash, user_id) VALUES ($1, $2)`, hash[:], userID)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = strings.Join([]string{plaintext[0:4], plaintext[4:8], plaintext[8:12], plaintext[12:16]}, "-")
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode() undoes the grouping and any change of case, so a recovery
+// code is accepted however the user has typed it.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -11,17 +11,37 @@ var (
 )
 
 type Models struct {
-	EdToys      EdtoysModel
-	Permissions PermissionModel
-	Tokens      TokenModel
-	Users       UserModel
+	Copies       CopyModel
+	EdToys       EdtoysModel
+	Loans        LoanModel
+	Media        MediaModel
+	MFA          MFAModel
+	Permissions  PermissionModel
+	Reservations ReservationModel
+	Reviews      ReviewModel
+	Revisions    RevisionModel
+	Taxonomy     TaxonomyModel
+	Tokens       TokenModel
+	Translations TranslationModel
+	Users        UserModel
+	Wishlists    WishlistModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		EdToys:      EdtoysModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		Copies:       CopyModel{DB: db},
+		EdToys:       EdtoysModel{DB: db},
+		Loans:        LoanModel{DB: db},
+		Media:        MediaModel{DB: db},
+		MFA:          MFAModel{DB: db},
+		Permissions:  PermissionModel{DB: db},
+		Reservations: ReservationModel{DB: db},
+		Reviews:      ReviewModel{DB: db},
+		Revisions:    RevisionModel{DB: db},
+		Taxonomy:     TaxonomyModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Translations: TranslationModel{DB: db},
+		Users:        UserModel{DB: db},
+		Wishlists:    WishlistModel{DB: db},
 	}
 }
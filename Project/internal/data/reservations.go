@@ -0,0 +1,107 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrDuplicateReservation = errors.New("duplicate reservation")
+
+// Reservation is a user's place in the queue for a record whose copies are all out.
+type Reservation struct {
+	ID        int64     `json:"id"`
+	EdtoyID   int64     `json:"edtoy_id"`
+	Title     string    `json:"title"`
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Position is the user's place in the queue, starting at 1.
+	Position int `json:"position"`
+}
+
+type ReservationModel struct {
+	DB *sql.DB
+}
+
+func (m ReservationModel) Insert(reservation *Reservation) error {
+	query := `
+INSERT INTO reservations (edtoy_id, user_id)
+VALUES ($1, $2)
+RETURNING id, created_at, (SELECT count(*) + 1 FROM reservations WHERE edtoy_id = $1)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, reservation.EdtoyID, reservation.UserID).Scan(
+		&reservation.ID,
+		&reservation.CreatedAt,
+		&reservation.Position,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reservations_edtoy_id_user_id_key"`:
+			return ErrDuplicateReservation
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllForUser() returns a user's reservations along with their place in each queue.
+func (m ReservationModel) GetAllForUser(userID int64) ([]*Reservation, error) {
+	query := `
+SELECT queued.id, queued.edtoy_id, edtoys.title, queued.user_id, queued.created_at, queued.position
+FROM (
+	SELECT reservations.*, row_number() OVER (PARTITION BY edtoy_id ORDER BY created_at, id) AS position
+	FROM reservations) AS queued
+INNER JOIN edtoys ON edtoys.id = queued.edtoy_id
+WHERE queued.user_id = $1
+ORDER BY queued.created_at, queued.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reservations := []*Reservation{}
+	for rows.Next() {
+		var reservation Reservation
+		err := rows.Scan(
+			&reservation.ID,
+			&reservation.EdtoyID,
+			&reservation.Title,
+			&reservation.UserID,
+			&reservation.CreatedAt,
+			&reservation.Position,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, &reservation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+func (m ReservationModel) DeleteForUser(edtoyID, userID int64) error {
+	query := `
+DELETE FROM reservations
+WHERE edtoy_id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, edtoyID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
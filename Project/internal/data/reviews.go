@@ -0,0 +1,284 @@
+package data
+
+import (
+	"Project/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrDuplicateReview = errors.New("duplicate review")
+
+var (
+	// Reviews are plain text, so anything that looks like an HTML tag is refused
+	// outright rather than being escaped and displayed.
+	htmlTagRX = regexp.MustCompile(`<\s*/?\s*[a-zA-Z!][^>]*>`)
+	linkRX    = regexp.MustCompile(`(?i)\b(?:https?://|www\.)`)
+)
+
+// The most links a review may contain before it is treated as spam.
+const maxReviewLinks = 2
+
+type Review struct {
+	ID        int64     `json:"id"`
+	EdtoyID   int64     `json:"edtoy_id"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Rating    int       `json:"rating"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int32     `json:"version"`
+}
+
+// validateReviewText() applies the checks shared by the title and body: valid UTF-8,
+// no control characters (other than line breaks and tabs in the body), no markup and a
+// limited number of links.
+func validateReviewText(v *validator.Validator, key, text string, multiline bool) {
+	v.Check(utf8.ValidString(text), key, "must be valid UTF-8")
+	v.Check(strings.IndexFunc(text, func(r rune) bool {
+		if multiline && (r == '\n' || r == '\r' || r == '\t') {
+			return false
+		}
+		return unicode.IsControl(r)
+	}) == -1, key, "must not contain control characters")
+	v.Check(!htmlTagRX.MatchString(text), key, "must not contain HTML")
+	v.Check(len(linkRX.FindAllStringIndex(text, -1)) <= maxReviewLinks, key, fmt.Sprintf("must not contain more than %d links", maxReviewLinks))
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Rating >= 1 && review.Rating <= 5, "rating", "must be between 1 and 5")
+	v.Check(len(review.Title) <= 120, "title", "must not be more than 120 bytes long")
+	validateReviewText(v, "title", review.Title, false)
+	v.Check(strings.TrimSpace(review.Body) != "", "body", "must be provided")
+	v.Check(len(review.Body) <= 4000, "body", "must not be more than 4000 bytes long")
+	validateReviewText(v, "body", review.Body, true)
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+// lockForRating() locks the reviewed record's row for the rest of the transaction. It
+// must come before the change to the reviews table: under READ COMMITTED each statement
+// only sees rows committed before it started, so without the lock two reviews written at
+// once would each recalculate the rating without the other, and the summary would stay
+// wrong. With it, the second transaction waits, and its later statements see the first
+// one's review.
+func lockForRating(ctx context.Context, tx *sql.Tx, edtoyID int64) error {
+	_, err := tx.ExecContext(ctx, `SELECT id FROM edtoys WHERE id = $1 FOR UPDATE`, edtoyID)
+	return err
+}
+
+// refreshRating() recalculates the denormalised rating summary on the reviewed record.
+// It runs in the same transaction as the change to the reviews table, after
+// lockForRating().
+func refreshRating(ctx context.Context, tx *sql.Tx, edtoyID int64) error {
+	query := `
+UPDATE edtoys
+SET (average_rating, review_count) = (
+	SELECT coalesce(round(avg(rating), 2), 0), count(*)
+	FROM reviews
+	WHERE edtoy_id = $1)
+WHERE id = $1`
+	_, err := tx.ExecContext(ctx, query, edtoyID)
+	return err
+}
+
+func (m ReviewModel) Insert(review *Review) error {
+	query := `
+INSERT INTO reviews (edtoy_id, user_id, rating, title, body)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, created_at, updated_at, version`
+	args := []interface{}{review.EdtoyID, review.UserID, review.Rating, review.Title, review.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockForRating(ctx, tx, review.EdtoyID)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_edtoy_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+	err = refreshRating(ctx, tx, review.EdtoyID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetForUser() returns the review that a user wrote for a record.
+func (m ReviewModel) GetForUser(edtoyID, userID int64) (*Review, error) {
+	query := `
+SELECT reviews.id, reviews.edtoy_id, reviews.user_id, users.name, reviews.rating, reviews.title,
+	reviews.body, reviews.created_at, reviews.updated_at, reviews.version
+FROM reviews
+INNER JOIN users ON users.id = reviews.user_id
+WHERE reviews.edtoy_id = $1 AND reviews.user_id = $2`
+	var review Review
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, edtoyID, userID).Scan(
+		&review.ID,
+		&review.EdtoyID,
+		&review.UserID,
+		&review.UserName,
+		&review.Rating,
+		&review.Title,
+		&review.Body,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &review, nil
+}
+
+func (m ReviewModel) GetAllForEdtoy(edtoyID int64, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), reviews.id, reviews.edtoy_id, reviews.user_id, users.name, reviews.rating,
+	reviews.title, reviews.body, reviews.created_at, reviews.updated_at, reviews.version
+FROM reviews
+INNER JOIN users ON users.id = reviews.user_id
+WHERE reviews.edtoy_id = $1
+ORDER BY reviews.%s %s, reviews.id ASC
+LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, edtoyID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.EdtoyID,
+			&review.UserID,
+			&review.UserName,
+			&review.Rating,
+			&review.Title,
+			&review.Body,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return reviews, metadata, nil
+}
+
+func (m ReviewModel) Update(review *Review) error {
+	query := `
+UPDATE reviews
+SET rating = $1, title = $2, body = $3, updated_at = now(), version = version + 1
+WHERE id = $4 AND version = $5
+RETURNING updated_at, version`
+	args := []interface{}{review.Rating, review.Title, review.Body, review.ID, review.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockForRating(ctx, tx, review.EdtoyID)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	err = refreshRating(ctx, tx, review.EdtoyID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteForUser() deletes the review that a user wrote for a record.
+func (m ReviewModel) DeleteForUser(edtoyID, userID int64) error {
+	query := `
+DELETE FROM reviews
+WHERE edtoy_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockForRating(ctx, tx, edtoyID)
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, query, edtoyID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	err = refreshRating(ctx, tx, edtoyID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
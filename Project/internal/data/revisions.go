@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// RevisionSnapshot holds the editable fields of an educational toy as they stood at a
+// particular version.
+type RevisionSnapshot struct {
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	Year         int32    `json:"year"`
+	TargetAge    string   `json:"target_age"`
+	MinAgeMonths int32    `json:"min_age_months"`
+	MaxAgeMonths *int32   `json:"max_age_months"`
+	Genres       []string `json:"genres"`
+	SkillFocus   []string `json:"skill_focus"`
+	Runtime      Runtime  `json:"runtime"`
+}
+
+// FieldChange records the old and new value of a single field.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// A Revision is a prior version of an educational toy. Snapshot holds the record as it
+// was at Version, and Changes lists the fields that the edit made by UserID changed
+// when it replaced that version. UserID is nil if the user has since been deleted.
+type Revision struct {
+	ID        int64                  `json:"id"`
+	EdtoyID   int64                  `json:"edtoy_id"`
+	Version   int32                  `json:"version"`
+	UserID    *int64                 `json:"user_id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Changes   map[string]FieldChange `json:"changes"`
+	Snapshot  RevisionSnapshot       `json:"snapshot"`
+}
+
+func snapshotEdtoys(edtoys *Edtoys) RevisionSnapshot {
+	return RevisionSnapshot{
+		Title:        edtoys.Title,
+		Description:  edtoys.Description,
+		Year:         edtoys.Year,
+		TargetAge:    edtoys.TargetAge,
+		MinAgeMonths: edtoys.MinAgeMonths,
+		MaxAgeMonths: edtoys.MaxAgeMonths,
+		Genres:       edtoys.Genres,
+		SkillFocus:   edtoys.SkillFocus,
+		Runtime:      edtoys.Runtime,
+	}
+}
+
+// Apply copies the snapshot's values onto a record, leaving its ID and version alone.
+func (s RevisionSnapshot) Apply(edtoys *Edtoys) {
+	edtoys.Title = s.Title
+	edtoys.Description = s.Description
+	edtoys.Year = s.Year
+	edtoys.TargetAge = s.TargetAge
+	edtoys.MinAgeMonths = s.MinAgeMonths
+	edtoys.MaxAgeMonths = s.MaxAgeMonths
+	edtoys.Genres = s.Genres
+	edtoys.SkillFocus = s.SkillFocus
+	edtoys.Runtime = s.Runtime
+}
+
+// diffSnapshots() returns the fields which differ between two snapshots, keyed by their
+// JSON name.
+func diffSnapshots(from, to RevisionSnapshot) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	fromValue, toValue := reflect.ValueOf(from), reflect.ValueOf(to)
+	for i := 0; i < fromValue.NumField(); i++ {
+		a, b := fromValue.Field(i).Interface(), toValue.Field(i).Interface()
+		if !reflect.DeepEqual(a, b) {
+			changes[fromValue.Type().Field(i).Tag.Get("json")] = FieldChange{From: a, To: b}
+		}
+	}
+	return changes
+}
+
+// insertRevision() records the previous state of a record within the transaction that
+// is replacing it.
+func insertRevision(ctx context.Context, tx *sql.Tx, previous, current *Edtoys, userID int64) error {
+	before, after := snapshotEdtoys(previous), snapshotEdtoys(current)
+	snapshot, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(diffSnapshots(before, after))
+	if err != nil {
+		return err
+	}
+	query := `
+INSERT INTO edtoys_revisions (edtoy_id, version, user_id, snapshot, changes)
+VALUES ($1, $2, $3, $4, $5)`
+	user := sql.NullInt64{Int64: userID, Valid: userID > 0}
+	_, err = tx.ExecContext(ctx, query, previous.ID, previous.Version, user, snapshot, changes)
+	return err
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForEdtoy() returns the revision history of a record, newest first.
+func (m RevisionModel) GetAllForEdtoy(edtoyID int64) ([]*Revision, error) {
+	query := `
+SELECT id, edtoy_id, version, user_id, created_at, changes, snapshot
+FROM edtoys_revisions
+WHERE edtoy_id = $1
+ORDER BY version DESC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, edtoyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := []*Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Get() returns the revision holding a record as it was at the given version.
+func (m RevisionModel) Get(edtoyID int64, version int32) (*Revision, error) {
+	query := `
+SELECT id, edtoy_id, version, user_id, created_at, changes, snapshot
+FROM edtoys_revisions
+WHERE edtoy_id = $1 AND version = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	revision, err := scanRevision(m.DB.QueryRowContext(ctx, query, edtoyID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return revision, nil
+}
+
+// scanRevision() reads a single revision from either a *sql.Row or *sql.Rows.
+func scanRevision(row interface{ Scan(...interface{}) error }) (*Revision, error) {
+	var (
+		revision          Revision
+		userID            sql.NullInt64
+		changes, snapshot []byte
+	)
+	err := row.Scan(
+		&revision.ID,
+		&revision.EdtoyID,
+		&revision.Version,
+		&userID,
+		&revision.CreatedAt,
+		&changes,
+		&snapshot,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		revision.UserID = &userID.Int64
+	}
+	if err := json.Unmarshal(changes, &revision.Changes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(snapshot, &revision.Snapshot); err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
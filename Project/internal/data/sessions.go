@@ -0,0 +1,237 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrRefreshTokenReused is returned when a refresh token that has already been
+// exchanged is presented again. Only one of the two parties holding it can be the
+// legitimate client, so the whole session is revoked.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// A Session is a sign-in as it's shown to its owner: the family of access and refresh
+// tokens issued from it. IP and UserAgent are those of the client that last used it,
+// Expiry is when its current refresh token runs out, and Current marks the session the
+// request listing them was made from.
+type Session struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Expiry     time.Time `json:"expiry"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+}
+
+// NewSession() starts a token family for the user and issues its first short-lived
+// access token and long-lived refresh token. A zero accessTTL skips the access token,
+// for callers that issue stateless signed access tokens instead; the family ID they
+// need for those is on the refresh token.
+func (m TokenModel) NewSession(userID int64, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+INSERT INTO token_families (user_id, ip, user_agent)
+VALUES ($1, $2, $3)
+RETURNING id`
+	var familyID int64
+	err = tx.QueryRowContext(ctx, query, userID, ip, userAgent).Scan(&familyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	access, refresh, err := issueSessionTokens(ctx, tx, userID, familyID, accessTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, tx.Commit()
+}
+
+// Refresh() exchanges a refresh token for a new access token and a new refresh token in
+// the same family. The old refresh token is kept but marked as used, and presenting it
+// again revokes the family and returns ErrRefreshTokenReused. A refresh token which is
+// unknown or expired gives ErrRecordNotFound. As with NewSession(), a zero accessTTL
+// skips the access token.
+func (m TokenModel) Refresh(refreshPlaintext string, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	refreshHash := sha256.Sum256([]byte(refreshPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the token so that two concurrent refreshes with it can't both succeed; the
+	// second one waits and then sees it as reused.
+	query := `
+SELECT user_id, family_id, used_at
+FROM tokens
+WHERE hash = $1 AND scope = $2 AND expiry > $3
+FOR UPDATE`
+	var userID, familyID int64
+	var usedAt *time.Time
+	err = tx.QueryRowContext(ctx, query, refreshHash[:], ScopeRefresh, time.Now()).Scan(&userID, &familyID, &usedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	if usedAt != nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM token_families WHERE id = $1`, familyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = now() WHERE hash = $1`, refreshHash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	query = `
+UPDATE token_families
+SET last_used_at = now(), ip = $2, user_agent = $3
+WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, familyID, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	access, refresh, err := issueSessionTokens(ctx, tx, userID, familyID, accessTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, tx.Commit()
+}
+
+// issueSessionTokens() creates and inserts an access token (unless accessTTL is zero)
+// and a refresh token in the given family.
+func issueSessionTokens(ctx context.Context, tx *sql.Tx, userID, familyID int64, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	tokens := make([]*Token, 2)
+	for i, t := range []struct {
+		ttl   time.Duration
+		scope string
+	}{{accessTTL, ScopeAuthentication}, {refreshTTL, ScopeRefresh}} {
+		if t.ttl == 0 {
+			continue
+		}
+		token, err := generateToken(userID, t.ttl, t.scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		token.FamilyID = familyID
+		token.IP = ip
+		token.UserAgent = userAgent
+		_, err = tx.ExecContext(ctx, insertTokenQuery, insertTokenArgs(token)...)
+		if err != nil {
+			return nil, nil, err
+		}
+		tokens[i] = token
+	}
+	return tokens[0], tokens[1], nil
+}
+
+// GetSessionsForUser() lists a user's sessions which still hold an unexpired token,
+// most recently used first, marking the one with the given ID as current.
+func (m TokenModel) GetSessionsForUser(userID, currentID int64) ([]*Session, error) {
+	query := `
+SELECT token_families.id, token_families.created_at, token_families.last_used_at,
+	max(tokens.expiry), token_families.ip, token_families.user_agent, token_families.id = $2
+FROM token_families
+INNER JOIN tokens ON tokens.family_id = token_families.id
+WHERE token_families.user_id = $1 AND tokens.expiry > $3 AND tokens.used_at IS NULL
+GROUP BY token_families.id
+ORDER BY token_families.last_used_at DESC, token_families.id DESC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, currentID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*Session{}
+	for rows.Next() {
+		var s Session
+		err := rows.Scan(&s.ID, &s.CreatedAt, &s.LastUsedAt, &s.Expiry, &s.IP, &s.UserAgent, &s.Current)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteSessionForUser() revokes one of a user's sessions, along with every token in
+// it.
+func (m TokenModel) DeleteSessionForUser(id, userID int64) error {
+	query := `
+DELETE FROM token_families
+WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// SessionIDForToken() returns the ID of the session an opaque access token belongs to.
+func (m TokenModel) SessionIDForToken(accessPlaintext string) (int64, error) {
+	accessHash := sha256.Sum256([]byte(accessPlaintext))
+	query := `
+SELECT family_id
+FROM tokens
+WHERE hash = $1 AND scope = $2`
+	var id int64
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, accessHash[:], ScopeAuthentication).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// DeleteAllSessionsForUser() revokes every session a user has, such as after their
+// password has been changed.
+func (m TokenModel) DeleteAllSessionsForUser(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM token_families WHERE user_id = $1`, userID)
+	return err
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"Project/internal/validator"
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SimilarityWeights sets how much each signal counts towards the similarity score.
+// The weights are relative to each other; they're normalised before use, so the score
+// always falls between 0 and 1.
+type SimilarityWeights struct {
+	Genres     float64
+	SkillFocus float64
+	Age        float64
+	Year       float64
+}
+
+// DefaultSimilarityWeights favours what a toy is about over when it was made.
+var DefaultSimilarityWeights = SimilarityWeights{
+	Genres:     0.35,
+	SkillFocus: 0.35,
+	Age:        0.2,
+	Year:       0.1,
+}
+
+func (w SimilarityWeights) total() float64 {
+	return w.Genres + w.SkillFocus + w.Age + w.Year
+}
+
+func ValidateSimilarityWeights(v *validator.Validator, w SimilarityWeights) {
+	v.Check(w.Genres >= 0, "weight_genres", "must not be negative")
+	v.Check(w.SkillFocus >= 0, "weight_skill_focus", "must not be negative")
+	v.Check(w.Age >= 0, "weight_age", "must not be negative")
+	v.Check(w.Year >= 0, "weight_year", "must not be negative")
+	v.Check(w.total() > 0, "weights", "at least one weight must be greater than zero")
+}
+
+// Similar() ranks the other records by how alike they are to the given one and returns
+// the top few. Each signal scores between 0 and 1:
+//
+//   - genres and skill focus by the Jaccard index of the two arrays;
+//   - age by the gap in years between the two age ranges, 1 / (1 + gap), so
+//     overlapping ranges score 1;
+//   - year by 1 / (1 + difference / 5), so records five years apart score 0.5.
+//
+// The score is the weighted average of the four.
+func (m EdtoysModel) Similar(edToy *Edtoys, weights SimilarityWeights, limit int) ([]*Edtoys, error) {
+	query := `
+		SELECT id, created_at, title, description, year, target_age, min_age_months, max_age_months, genres, skill_focus, runtime, version, average_rating, review_count,
+			$4::float8 * similarity.genres + $5::float8 * similarity.skill_focus + $6::float8 * similarity.age + $7::float8 * similarity.year AS score
+		FROM edtoys,
+		LATERAL (SELECT
+			coalesce(
+				(SELECT count(*) FROM (SELECT unnest(edtoys.genres) INTERSECT SELECT unnest($2::text[])) AS shared)::float8 /
+				nullif((SELECT count(*) FROM (SELECT unnest(edtoys.genres) UNION SELECT unnest($2::text[])) AS combined), 0),
+				0) AS genres,
+			coalesce(
+				(SELECT count(*) FROM (SELECT unnest(edtoys.skill_focus) INTERSECT SELECT unnest($3::text[])) AS shared)::float8 /
+				nullif((SELECT count(*) FROM (SELECT unnest(edtoys.skill_focus) UNION SELECT unnest($3::text[])) AS combined), 0),
+				0) AS skill_focus,
+			1 / (1 + greatest(0,
+				edtoys.min_age_months - coalesce($9::integer, $11::integer),
+				$8::integer - coalesce(edtoys.max_age_months, $11::integer)) / 12.0)::float8 AS age,
+			1 / (1 + abs(edtoys.year - $10::integer) / 5.0)::float8 AS year
+		) AS similarity
+		WHERE edtoys.id <> $1 AND edtoys.deleted_at IS NULL
+		ORDER BY score DESC, id ASC
+		LIMIT $12`
+
+	total := weights.total()
+	args := []interface{}{
+		edToy.ID,
+		pq.Array(edToy.Genres),
+		pq.Array(edToy.SkillFocus),
+		weights.Genres / total,
+		weights.SkillFocus / total,
+		weights.Age / total,
+		weights.Year / total,
+		edToy.MinAgeMonths,
+		edToy.MaxAgeMonths,
+		edToy.Year,
+		maxAgeMonths,
+		limit,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edToys := []*Edtoys{}
+	for rows.Next() {
+		var similar Edtoys
+		err := rows.Scan(
+			&similar.ID,
+			&similar.CreatedAt,
+			&similar.Title,
+			&similar.Description,
+			&similar.Year,
+			&similar.TargetAge,
+			&similar.MinAgeMonths,
+			&similar.MaxAgeMonths,
+			pq.Array(&similar.Genres),
+			pq.Array(&similar.SkillFocus),
+			&similar.Runtime,
+			&similar.Version,
+			&similar.AverageRating,
+			&similar.ReviewCount,
+			&similar.Similarity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		edToys = append(edToys, &similar)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return edToys, nil
+}
@@ -0,0 +1,536 @@
+package data
+
+import (
+	"Project/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The kinds of taxonomy term, and the edtoys column that each one is used in.
+const (
+	TermKindGenre = "genre"
+	TermKindSkill = "skill"
+)
+
+var termColumns = map[string]string{
+	TermKindGenre: "genres",
+	TermKindSkill: "skill_focus",
+}
+
+var (
+	ErrDuplicateTerm    = errors.New("duplicate term")
+	ErrDuplicateSynonym = errors.New("duplicate synonym")
+	ErrTermInUse        = errors.New("term in use")
+	ErrTermCycle        = errors.New("term hierarchy cycle")
+)
+
+// Slugs are made of letters and digits from any script, so that values in Kazakh or
+// Russian keep their meaning rather than collapsing into one another.
+var slugRX = regexp.MustCompile(`^[\p{L}\p{M}\p{N}]+(-[\p{L}\p{M}\p{N}]+)*$`)
+
+// Term is an entry in the genre or skill taxonomy. Records refer to terms by slug.
+type Term struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Parent    string    `json:"parent,omitempty"`
+	Synonyms  []string  `json:"synonyms"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateTerm(v *validator.Validator, term *Term) {
+	v.Check(term.Slug != "", "slug", "must be provided")
+	v.Check(len(term.Slug) <= 50, "slug", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(term.Slug, slugRX) && term.Slug == strings.ToLower(term.Slug), "slug", "must only contain lower case letters, digits and single hyphens")
+	v.Check(term.Name != "", "name", "must be provided")
+	v.Check(len(term.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(term.Parent != term.Slug, "parent", "must not be the term itself")
+	v.Check(len(term.Synonyms) <= 20, "synonyms", "must not contain more than 20 synonyms")
+	for _, synonym := range term.Synonyms {
+		if strings.TrimSpace(synonym) == "" || len(synonym) > 100 {
+			v.AddError("synonyms", "must only contain values between 1 and 100 bytes long")
+			break
+		}
+	}
+}
+
+// Taxonomy is a snapshot of the known terms, used to canonicalise and check the genres
+// and skill focus of a record.
+type Taxonomy struct {
+	// slugs maps kind -> slug -> true.
+	slugs map[string]map[string]bool
+	// lookup maps kind -> lower-cased slug, name or synonym -> slug.
+	lookup map[string]map[string]string
+}
+
+// Canonical() returns the slug for a value given as a slug, display name or synonym,
+// ignoring case. Values that aren't recognised are returned unchanged.
+func (t *Taxonomy) Canonical(kind, value string) string {
+	if slug, ok := t.lookup[kind][strings.ToLower(strings.TrimSpace(value))]; ok {
+		return slug
+	}
+	return value
+}
+
+// CanonicalAll() applies Canonical() to each value, dropping any duplicates this
+// creates.
+func (t *Taxonomy) CanonicalAll(kind string, values []string) []string {
+	if values == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(values))
+	canonical := make([]string, 0, len(values))
+	for _, value := range values {
+		slug := t.Canonical(kind, value)
+		if !seen[slug] {
+			seen[slug] = true
+			canonical = append(canonical, slug)
+		}
+	}
+	return canonical
+}
+
+// Canonicalize() rewrites the genres and skill focus of a record to slugs.
+func (t *Taxonomy) Canonicalize(edtoys *Edtoys) {
+	edtoys.Genres = t.CanonicalAll(TermKindGenre, edtoys.Genres)
+	edtoys.SkillFocus = t.CanonicalAll(TermKindSkill, edtoys.SkillFocus)
+}
+
+// CanonicalizeCriteria() rewrites the genre and skill filters of a listing to slugs,
+// so that filtering by a display name or synonym finds the records using that term.
+func (t *Taxonomy) CanonicalizeCriteria(c *EdtoysCriteria) {
+	c.Genres = t.CanonicalAll(TermKindGenre, c.Genres)
+	c.SkillFocus = t.CanonicalAll(TermKindSkill, c.SkillFocus)
+}
+
+// unknown() returns the first value that isn't a known slug of the given kind.
+func (t *Taxonomy) unknown(kind string, values []string) (string, bool) {
+	for _, value := range values {
+		if !t.slugs[kind][value] {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+type TaxonomyModel struct {
+	DB *sql.DB
+}
+
+// Load() reads the whole taxonomy into memory. It's small, so this is cheaper than
+// looking terms up one at a time.
+func (m TaxonomyModel) Load() (*Taxonomy, error) {
+	query := `
+SELECT taxonomy_terms.kind, taxonomy_terms.slug, taxonomy_terms.name,
+	coalesce(array_agg(taxonomy_synonyms.synonym) FILTER (WHERE taxonomy_synonyms.synonym IS NOT NULL), '{}')
+FROM taxonomy_terms
+LEFT JOIN taxonomy_synonyms ON taxonomy_synonyms.term_id = taxonomy_terms.id
+GROUP BY taxonomy_terms.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	t := &Taxonomy{
+		slugs:  make(map[string]map[string]bool),
+		lookup: make(map[string]map[string]string),
+	}
+	for kind := range termColumns {
+		t.slugs[kind] = make(map[string]bool)
+		t.lookup[kind] = make(map[string]string)
+	}
+	for rows.Next() {
+		var kind, slug, name string
+		var synonyms []string
+		err := rows.Scan(&kind, &slug, &name, pq.Array(&synonyms))
+		if err != nil {
+			return nil, err
+		}
+		if t.slugs[kind] == nil {
+			continue
+		}
+		t.slugs[kind][slug] = true
+		// Slugs win over names and synonyms, then names over synonyms, so that a
+		// value is resolved the same way regardless of row order.
+		for _, synonym := range synonyms {
+			if _, ok := t.lookup[kind][synonym]; !ok {
+				t.lookup[kind][synonym] = slug
+			}
+		}
+		t.lookup[kind][strings.ToLower(name)] = slug
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for kind, slugs := range t.slugs {
+		for slug := range slugs {
+			t.lookup[kind][slug] = slug
+		}
+	}
+	return t, nil
+}
+
+const termQuery = `
+SELECT taxonomy_terms.id, taxonomy_terms.kind, taxonomy_terms.slug, taxonomy_terms.name,
+	coalesce(parents.slug, ''),
+	coalesce(array_agg(taxonomy_synonyms.synonym ORDER BY taxonomy_synonyms.synonym)
+		FILTER (WHERE taxonomy_synonyms.synonym IS NOT NULL), '{}'),
+	taxonomy_terms.created_at, taxonomy_terms.version
+FROM taxonomy_terms
+LEFT JOIN taxonomy_terms AS parents ON parents.id = taxonomy_terms.parent_id
+LEFT JOIN taxonomy_synonyms ON taxonomy_synonyms.term_id = taxonomy_terms.id
+WHERE taxonomy_terms.kind = $1 AND (taxonomy_terms.slug = $2 OR $2 = '')
+GROUP BY taxonomy_terms.id, parents.slug
+ORDER BY taxonomy_terms.slug`
+
+func scanTerm(scan func(dest ...interface{}) error) (*Term, error) {
+	var term Term
+	err := scan(
+		&term.ID,
+		&term.Kind,
+		&term.Slug,
+		&term.Name,
+		&term.Parent,
+		pq.Array(&term.Synonyms),
+		&term.CreatedAt,
+		&term.Version,
+	)
+	return &term, err
+}
+
+// GetAll() lists the terms of a kind in slug order.
+func (m TaxonomyModel) GetAll(kind string) ([]*Term, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, termQuery, kind, "")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	terms := []*Term{}
+	for rows.Next() {
+		term, err := scanTerm(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+func (m TaxonomyModel) Get(kind, slug string) (*Term, error) {
+	if slug == "" {
+		return nil, ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	term, err := scanTerm(m.DB.QueryRowContext(ctx, termQuery, kind, slug).Scan)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return term, nil
+}
+
+// termError() translates the constraint violations a term write can run into.
+func termError(err error) error {
+	switch {
+	case err.Error() == `pq: duplicate key value violates unique constraint "taxonomy_terms_kind_slug_key"`:
+		return ErrDuplicateTerm
+	case err.Error() == `pq: duplicate key value violates unique constraint "taxonomy_synonyms_pkey"`:
+		return ErrDuplicateSynonym
+	default:
+		return err
+	}
+}
+
+// setSynonyms() replaces the synonyms of a term.
+func setSynonyms(ctx context.Context, tx *sql.Tx, term *Term) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM taxonomy_synonyms WHERE term_id = $1`, term.ID)
+	if err != nil {
+		return err
+	}
+	synonyms := make([]string, len(term.Synonyms))
+	for i, synonym := range term.Synonyms {
+		synonyms[i] = strings.ToLower(strings.TrimSpace(synonym))
+	}
+	query := `
+INSERT INTO taxonomy_synonyms (kind, synonym, term_id)
+SELECT DISTINCT $1, synonym, $2::bigint
+FROM unnest($3::text[]) AS synonym`
+	_, err = tx.ExecContext(ctx, query, term.Kind, term.ID, pq.Array(synonyms))
+	return termError(err)
+}
+
+// parentID() resolves a parent slug to its ID, or nil for a top-level term.
+func parentID(ctx context.Context, tx *sql.Tx, kind, slug string) (*int64, error) {
+	if slug == "" {
+		return nil, nil
+	}
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM taxonomy_terms WHERE kind = $1 AND slug = $2`, kind, slug).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &id, nil
+}
+
+// Insert() adds a term and its synonyms. It returns ErrRecordNotFound if the parent
+// doesn't exist.
+func (m TaxonomyModel) Insert(term *Term) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	parent, err := parentID(ctx, tx, term.Kind, term.Parent)
+	if err != nil {
+		return err
+	}
+	query := `
+INSERT INTO taxonomy_terms (kind, slug, name, parent_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, version`
+	err = tx.QueryRowContext(ctx, query, term.Kind, term.Slug, term.Name, parent).Scan(&term.ID, &term.CreatedAt, &term.Version)
+	if err != nil {
+		return termError(err)
+	}
+	err = setSynonyms(ctx, tx, term)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Update() saves a term's name, parent and synonyms. Slugs can't be changed here since
+// records refer to them; use Merge() to fold one term into another instead.
+func (m TaxonomyModel) Update(term *Term) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	parent, err := parentID(ctx, tx, term.Kind, term.Parent)
+	if err != nil {
+		return err
+	}
+	if parent != nil {
+		// The new parent mustn't be the term itself or one of its descendants.
+		var cycle bool
+		query := `
+WITH RECURSIVE ancestors AS (
+	SELECT id, parent_id FROM taxonomy_terms WHERE id = $1
+	UNION
+	SELECT taxonomy_terms.id, taxonomy_terms.parent_id
+	FROM taxonomy_terms
+	INNER JOIN ancestors ON taxonomy_terms.id = ancestors.parent_id
+)
+SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`
+		err = tx.QueryRowContext(ctx, query, *parent, term.ID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrTermCycle
+		}
+	}
+	query := `
+UPDATE taxonomy_terms
+SET name = $1, parent_id = $2, version = version + 1
+WHERE id = $3 AND version = $4
+RETURNING version`
+	err = tx.QueryRowContext(ctx, query, term.Name, parent, term.ID, term.Version).Scan(&term.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	err = setSynonyms(ctx, tx, term)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete() removes a term that no record uses. Child terms move up to the top level.
+func (m TaxonomyModel) Delete(term *Term) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var inUse bool
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM edtoys WHERE %s @> ARRAY[$1])`, termColumns[term.Kind])
+	err := m.DB.QueryRowContext(ctx, query, term.Slug).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrTermInUse
+	}
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM taxonomy_terms WHERE id = $1`, term.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Merge() folds the term from into the term into: records using from are switched
+// over (bumping their version and recording a revision attributed to the given user, as
+// Update() does), from's slug, name and synonyms become synonyms of into, its children
+// move under into, and from is deleted. It returns the number of records that were
+// changed.
+func (m TaxonomyModel) Merge(from, into *Term, userID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	column := termColumns[from.Kind]
+	query := fmt.Sprintf(`
+SELECT id, created_at, title, description, year, target_age, min_age_months, max_age_months, genres, skill_focus, runtime, version
+FROM edtoys
+WHERE %s @> ARRAY[$1]
+ORDER BY id
+FOR UPDATE`, column)
+	rows, err := tx.QueryContext(ctx, query, from.Slug)
+	if err != nil {
+		return 0, err
+	}
+	var affected []*Edtoys
+	for rows.Next() {
+		var edToy Edtoys
+		err := rows.Scan(
+			&edToy.ID,
+			&edToy.CreatedAt,
+			&edToy.Title,
+			&edToy.Description,
+			&edToy.Year,
+			&edToy.TargetAge,
+			&edToy.MinAgeMonths,
+			&edToy.MaxAgeMonths,
+			pq.Array(&edToy.Genres),
+			pq.Array(&edToy.SkillFocus),
+			&edToy.Runtime,
+			&edToy.Version,
+		)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		affected = append(affected, &edToy)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	query = fmt.Sprintf(`
+UPDATE edtoys
+SET %s = $1, version = version + 1
+WHERE id = $2
+RETURNING version`, column)
+	for _, previous := range affected {
+		current := *previous
+		if from.Kind == TermKindGenre {
+			current.Genres = replaceTerm(previous.Genres, from.Slug, into.Slug)
+			err = tx.QueryRowContext(ctx, query, pq.Array(current.Genres), current.ID).Scan(&current.Version)
+		} else {
+			current.SkillFocus = replaceTerm(previous.SkillFocus, from.Slug, into.Slug)
+			err = tx.QueryRowContext(ctx, query, pq.Array(current.SkillFocus), current.ID).Scan(&current.Version)
+		}
+		if err != nil {
+			return 0, err
+		}
+		err = insertRevision(ctx, tx, previous, &current, userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// The slug and the lower-cased name are often the same, so they're deduplicated:
+	// ON CONFLICT can't update the same row twice in one statement.
+	query = `
+INSERT INTO taxonomy_synonyms (kind, synonym, term_id)
+SELECT DISTINCT $1, synonym, $3::bigint
+FROM unnest(ARRAY[$4::text, lower($5::text)]) AS synonym
+WHERE synonym <> $2
+ON CONFLICT (kind, synonym) DO UPDATE SET term_id = EXCLUDED.term_id`
+	_, err = tx.ExecContext(ctx, query, into.Kind, into.Slug, into.ID, from.Slug, from.Name)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE taxonomy_synonyms SET term_id = $1 WHERE term_id = $2`, into.ID, from.ID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE taxonomy_terms SET parent_id = $1 WHERE parent_id = $2 AND id <> $1`, into.ID, from.ID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM taxonomy_terms WHERE id = $1`, from.ID)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(affected)), tx.Commit()
+}
+
+// replaceTerm() returns a copy of values with from replaced by into, dropping any
+// duplicate this creates while keeping the original order.
+func replaceTerm(values []string, from, into string) []string {
+	seen := make(map[string]bool, len(values))
+	replaced := make([]string, 0, len(values))
+	for _, value := range values {
+		if value == from {
+			value = into
+		}
+		if !seen[value] {
+			seen[value] = true
+			replaced = append(replaced, value)
+		}
+	}
+	return replaced
+}
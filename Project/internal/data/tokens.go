@@ -15,6 +15,9 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeMFA            = "mfa"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
 )
 
 // Define a Token struct to hold the data for an individual token. This includes the
@@ -26,6 +29,12 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// FamilyID is the session that an authentication or refresh token belongs to.
+	FamilyID int64 `json:"-"`
+	// IP and UserAgent describe the client an authentication token was issued to, so
+	// that the user can tell their sessions apart.
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -37,6 +46,18 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 		Expiry: time.Now().Add(ttl),
 		Scope:  scope,
 	}
+	var err error
+	token.Plaintext, token.Hash, err = randomToken()
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// randomToken() returns a new random plaintext token along with the SHA-256 hash that
+// we store in place of it. It's shared by the tokens table and anything else that hands
+// out unguessable links, such as shared wishlists.
+func randomToken() (string, []byte, error) {
 	// Initialize a zero-valued byte slice with a length of 16 bytes.
 	randomBytes := make([]byte, 16)
 	// Use the Read() function from the crypto/rand package to fill the byte slice with
@@ -44,26 +65,25 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	// the CSPRNG fails to function correctly.
 	_, err := rand.Read(randomBytes)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
-	// Encode the byte slice to a base-32-encoded string and assign it to the token
-	// Plaintext field. This will be the token string that we send to the user in their
-	// welcome email. They will look similar to this:
+	// Encode the byte slice to a base-32-encoded string. This will be the token string
+	// that we send to the user in their welcome email. They will look similar to this:
 	//
 	// Y3QMGX3PJ3WLRL2YRTQGQ6KRHU
 	//
 	// Note that by default base-32 strings may be padded at the end with the =
 	// character. We don't need this padding character for the purpose of our tokens, so
 	// we use the WithPadding(base32.NoPadding) method in the line below to omit them.
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
 	// Generate a SHA-256 hash of the plaintext token string. This will be the value
 	// that we store in the `hash` field of our database table. Note that the
 	// sha256.Sum256() function returns an *array* of length 32, so to make it easier to
 	// work with we convert it to a slice using the [:] operator before storing it.
-	hash := sha256.Sum256([]byte(token.Plaintext))
-	token.Hash = hash[:]
-	return token, nil
+	hash := sha256.Sum256([]byte(plaintext))
+	return plaintext, hash[:], nil
 }
+
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
@@ -87,16 +107,21 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 
 // Insert() adds the data for a specific token to the tokens table.
 func (m TokenModel) Insert(token *Token) error {
-	query := `
-INSERT INTO tokens (hash, user_id, expiry, scope)
-VALUES ($1, $2, $3, $4)`
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := m.DB.ExecContext(ctx, insertTokenQuery, insertTokenArgs(token)...)
 	return err
 }
 
+// A zero FamilyID is stored as NULL, for tokens that aren't part of a session.
+const insertTokenQuery = `
+INSERT INTO tokens (hash, user_id, expiry, scope, ip, user_agent, family_id)
+VALUES ($1, $2, $3, $4, $5, $6, nullif($7::bigint, 0))`
+
+func insertTokenArgs(token *Token) []interface{} {
+	return []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.IP, token.UserAgent, token.FamilyID}
+}
+
 // DeleteAllForUser() deletes all tokens for a specific user and scope.
 func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	query := `
@@ -0,0 +1,232 @@
+package data
+
+import (
+	"Project/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultLocale is the language records themselves are written in. Every other
+// supported locale is stored as a translation.
+const DefaultLocale = "en"
+
+// localeFallbacks maps each supported locale to the locale tried next when a record
+// has no translation into it. The chain always ends at DefaultLocale.
+var localeFallbacks = map[string]string{
+	"en": "",
+	"ru": "en",
+	"kk": "ru",
+}
+
+// SupportedLocale reports whether content can be served in the given locale.
+func SupportedLocale(locale string) bool {
+	_, ok := localeFallbacks[locale]
+	return ok
+}
+
+// LocaleFallbacks returns the given supported locale followed by the locales to fall
+// back to, in order, ending with DefaultLocale.
+func LocaleFallbacks(locale string) []string {
+	var chain []string
+	for ; locale != ""; locale = localeFallbacks[locale] {
+		chain = append(chain, locale)
+	}
+	return chain
+}
+
+// Translation holds the title and description of a record in a locale other than
+// DefaultLocale.
+type Translation struct {
+	EdtoyID     int64     `json:"-"`
+	Locale      string    `json:"locale"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int32     `json:"version"`
+}
+
+func ValidateTranslation(v *validator.Validator, t *Translation) {
+	v.Check(SupportedLocale(t.Locale), "locale", "must be a supported locale")
+	v.Check(t.Locale != DefaultLocale, "locale", "must not be the default locale; update the record itself instead")
+	v.Check(t.Title != "", "title", "must be provided")
+	v.Check(len(t.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(t.Description) <= maxDescriptionLength, "description", fmt.Sprintf("must not be more than %d bytes long", maxDescriptionLength))
+}
+
+type TranslationModel struct {
+	DB *sql.DB
+}
+
+// GetAllForEdtoy() returns every translation of a record, ordered by locale.
+func (m TranslationModel) GetAllForEdtoy(edtoyID int64) ([]*Translation, error) {
+	query := `
+SELECT edtoy_id, locale, title, description, updated_at, version
+FROM edtoys_translations
+WHERE edtoy_id = $1
+ORDER BY locale`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, edtoyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	translations := []*Translation{}
+	for rows.Next() {
+		var t Translation
+		err := rows.Scan(&t.EdtoyID, &t.Locale, &t.Title, &t.Description, &t.UpdatedAt, &t.Version)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, &t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+func (m TranslationModel) Get(edtoyID int64, locale string) (*Translation, error) {
+	query := `
+SELECT edtoy_id, locale, title, description, updated_at, version
+FROM edtoys_translations
+WHERE edtoy_id = $1 AND locale = $2`
+	var t Translation
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, edtoyID, locale).Scan(&t.EdtoyID, &t.Locale, &t.Title, &t.Description, &t.UpdatedAt, &t.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// Put() creates the translation or replaces an existing one, and reports whether it
+// was created. The record's own version is bumped in the same transaction, since its
+// localized representations have changed and their entity tags must change with them.
+func (m TranslationModel) Put(t *Translation) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	err = touchEdtoys(ctx, tx, t.EdtoyID)
+	if err != nil {
+		return false, err
+	}
+	// xmax is only zero on a freshly inserted row, which tells an insert apart from an
+	// update.
+	query := `
+INSERT INTO edtoys_translations (edtoy_id, locale, title, description)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (edtoy_id, locale) DO UPDATE
+SET title = EXCLUDED.title, description = EXCLUDED.description, updated_at = now(),
+	version = edtoys_translations.version + 1
+RETURNING updated_at, version, xmax = 0`
+	var created bool
+	err = tx.QueryRowContext(ctx, query, t.EdtoyID, t.Locale, t.Title, t.Description).Scan(&t.UpdatedAt, &t.Version, &created)
+	if err != nil {
+		return false, err
+	}
+	return created, tx.Commit()
+}
+
+// Delete() removes a translation, bumping the record's version like Put() does.
+func (m TranslationModel) Delete(edtoyID int64, locale string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM edtoys_translations WHERE edtoy_id = $1 AND locale = $2`, edtoyID, locale)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	err = touchEdtoys(ctx, tx, edtoyID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// touchEdtoys() bumps the version of a record that hasn't been moved to the trash.
+func touchEdtoys(ctx context.Context, tx *sql.Tx, edtoyID int64) error {
+	result, err := tx.ExecContext(ctx, `UPDATE edtoys SET version = version + 1 WHERE id = $1 AND deleted_at IS NULL`, edtoyID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Localize() swaps the title and description of each record for its translation into
+// the first locale of chain that it has one for, and sets Locale to the language the
+// record ended up in. Records with no matching translation stay in DefaultLocale.
+func (m TranslationModel) Localize(chain []string, edtoys ...*Edtoys) error {
+	byID := make(map[int64]*Edtoys, len(edtoys))
+	ids := make([]int64, 0, len(edtoys))
+	for _, e := range edtoys {
+		e.Locale = DefaultLocale
+		byID[e.ID] = e
+		ids = append(ids, e.ID)
+	}
+	if len(ids) == 0 || len(chain) == 0 || chain[0] == DefaultLocale {
+		return nil
+	}
+	// DISTINCT ON keeps the first row for each record, and array_position() orders the
+	// rows by how early their locale comes in the chain.
+	query := `
+SELECT DISTINCT ON (edtoy_id) edtoy_id, locale, title, description
+FROM edtoys_translations
+WHERE edtoy_id = ANY($1) AND locale = ANY($2)
+ORDER BY edtoy_id, array_position($2, locale)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids), pq.Array(chain))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t Translation
+		err := rows.Scan(&t.EdtoyID, &t.Locale, &t.Title, &t.Description)
+		if err != nil {
+			return err
+		}
+		if e, ok := byID[t.EdtoyID]; ok {
+			e.Locale, e.Title, e.Description = t.Locale, t.Title, t.Description
+		}
+	}
+	return rows.Err()
+}
@@ -23,13 +23,24 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	// MFAEnabled is set once the user has confirmed a TOTP authenticator, and
+	// MFARequired when an administrator has made two-factor authentication mandatory
+	// for them.
+	MFAEnabled  bool `json:"mfa_enabled"`
+	MFARequired bool `json:"mfa_required"`
+	Version     int  `json:"-"`
 }
 
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// NeedsMFAEnrollment reports whether the user has to set up two-factor authentication
+// before they can use their account.
+func (u *User) NeedsMFAEnrollment() bool {
+	return u.MFARequired && !u.MFAEnabled
+}
+
 type password struct {
 	plaintext *string
 	hash      []byte
@@ -103,9 +114,39 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, totp_enabled, mfa_required, version
+		FROM users
+		WHERE id = $1`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.MFAEnabled,
+		&user.MFARequired,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, totp_enabled, mfa_required, version
 		FROM users
 		WHERE email = $1`
 	var user User
@@ -118,6 +159,8 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.MFAEnabled,
+		&user.MFARequired,
 		&user.Version,
 	)
 	if err != nil {
@@ -167,7 +210,8 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	// Set up the SQL query.
 	query := `
-SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+	users.totp_enabled, users.mfa_required, users.version
 FROM users
 INNER JOIN tokens
 ON users.id = tokens.user_id
@@ -191,6 +235,8 @@ AND tokens.expiry > $3`
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.MFAEnabled,
+		&user.MFARequired,
 		&user.Version,
 	)
 	if err != nil {
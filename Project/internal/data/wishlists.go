@@ -0,0 +1,319 @@
+package data
+
+import (
+	"Project/internal/validator"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateWishlistItem = errors.New("duplicate wishlist item")
+
+type Wishlist struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Name      string    `json:"name"`
+	Shared    bool      `json:"shared"`
+	ItemCount int       `json:"item_count"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+	// Items is only filled in when a single wishlist is fetched.
+	Items []*WishlistItem `json:"items,omitempty"`
+}
+
+type WishlistItem struct {
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	EdToy    *Edtoys   `json:"educational_toy"`
+}
+
+func ValidateWishlist(v *validator.Validator, wishlist *Wishlist) {
+	v.Check(wishlist.Name != "", "name", "must be provided")
+	v.Check(len(wishlist.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+type WishlistModel struct {
+	DB *sql.DB
+}
+
+func (m WishlistModel) Insert(wishlist *Wishlist) error {
+	query := `
+INSERT INTO wishlists (user_id, name)
+VALUES ($1, $2)
+RETURNING id, created_at, version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, wishlist.UserID, wishlist.Name).Scan(&wishlist.ID, &wishlist.CreatedAt, &wishlist.Version)
+}
+
+func (m WishlistModel) GetAllForUser(userID int64) ([]*Wishlist, error) {
+	query := `
+SELECT wishlists.id, wishlists.user_id, wishlists.name, wishlists.share_hash IS NOT NULL,
+	count(wishlist_items.edtoy_id), wishlists.created_at, wishlists.version
+FROM wishlists
+LEFT JOIN wishlist_items ON wishlist_items.wishlist_id = wishlists.id
+WHERE wishlists.user_id = $1
+GROUP BY wishlists.id
+ORDER BY wishlists.created_at, wishlists.id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	wishlists := []*Wishlist{}
+	for rows.Next() {
+		var wishlist Wishlist
+		err := rows.Scan(
+			&wishlist.ID,
+			&wishlist.UserID,
+			&wishlist.Name,
+			&wishlist.Shared,
+			&wishlist.ItemCount,
+			&wishlist.CreatedAt,
+			&wishlist.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		wishlists = append(wishlists, &wishlist)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return wishlists, nil
+}
+
+// Get() fetches one of a user's wishlists along with its items. A wishlist belonging to
+// somebody else is reported as not found.
+func (m WishlistModel) Get(id, userID int64) (*Wishlist, error) {
+	query := `
+SELECT id, user_id, name, share_hash IS NOT NULL, created_at, version
+FROM wishlists
+WHERE id = $1 AND user_id = $2`
+	return m.get(query, id, userID)
+}
+
+// GetForShareToken() fetches a shared wishlist from the plaintext token in its link.
+func (m WishlistModel) GetForShareToken(tokenPlaintext string) (*Wishlist, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+SELECT id, user_id, name, share_hash IS NOT NULL, created_at, version
+FROM wishlists
+WHERE share_hash = $1`
+	return m.get(query, hash[:])
+}
+
+func (m WishlistModel) get(query string, args ...interface{}) (*Wishlist, error) {
+	var wishlist Wishlist
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&wishlist.ID,
+		&wishlist.UserID,
+		&wishlist.Name,
+		&wishlist.Shared,
+		&wishlist.CreatedAt,
+		&wishlist.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	wishlist.Items, err = m.items(ctx, wishlist.ID)
+	if err != nil {
+		return nil, err
+	}
+	wishlist.ItemCount = len(wishlist.Items)
+	return &wishlist, nil
+}
+
+// items() returns the entries on a wishlist in the order the owner arranged them.
+// Records that have since been moved to the trash are left out.
+func (m WishlistModel) items(ctx context.Context, wishlistID int64) ([]*WishlistItem, error) {
+	query := `
+SELECT wishlist_items.position, wishlist_items.added_at, edtoys.id, edtoys.created_at, edtoys.title,
+	edtoys.description, edtoys.year, edtoys.target_age, edtoys.min_age_months, edtoys.max_age_months, edtoys.genres,
+	edtoys.skill_focus, edtoys.runtime, edtoys.version, edtoys.average_rating, edtoys.review_count
+FROM wishlist_items
+INNER JOIN edtoys ON edtoys.id = wishlist_items.edtoy_id
+WHERE wishlist_items.wishlist_id = $1 AND edtoys.deleted_at IS NULL
+ORDER BY wishlist_items.position, wishlist_items.added_at`
+	rows, err := m.DB.QueryContext(ctx, query, wishlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*WishlistItem{}
+	for rows.Next() {
+		item := WishlistItem{EdToy: &Edtoys{}}
+		err := rows.Scan(
+			&item.Position,
+			&item.AddedAt,
+			&item.EdToy.ID,
+			&item.EdToy.CreatedAt,
+			&item.EdToy.Title,
+			&item.EdToy.Description,
+			&item.EdToy.Year,
+			&item.EdToy.TargetAge,
+			&item.EdToy.MinAgeMonths,
+			&item.EdToy.MaxAgeMonths,
+			pq.Array(&item.EdToy.Genres),
+			pq.Array(&item.EdToy.SkillFocus),
+			&item.EdToy.Runtime,
+			&item.EdToy.Version,
+			&item.EdToy.AverageRating,
+			&item.EdToy.ReviewCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (m WishlistModel) Update(wishlist *Wishlist) error {
+	query := `
+UPDATE wishlists
+SET name = $1, version = version + 1
+WHERE id = $2 AND user_id = $3 AND version = $4
+RETURNING version`
+	args := []interface{}{wishlist.Name, wishlist.ID, wishlist.UserID, wishlist.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&wishlist.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m WishlistModel) Delete(id, userID int64) error {
+	query := `
+DELETE FROM wishlists
+WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Share() gives the wishlist a new share token and returns its plaintext. Only the hash
+// is stored, so any earlier link stops working and the new one can't be shown again.
+func (m WishlistModel) Share(wishlist *Wishlist) (string, error) {
+	plaintext, hash, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	query := `
+UPDATE wishlists
+SET share_hash = $1
+WHERE id = $2 AND user_id = $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, query, hash, wishlist.ID, wishlist.UserID)
+	if err != nil {
+		return "", err
+	}
+	wishlist.Shared = true
+	return plaintext, nil
+}
+
+// Unshare() revokes the wishlist's share token.
+func (m WishlistModel) Unshare(wishlist *Wishlist) error {
+	query := `
+UPDATE wishlists
+SET share_hash = NULL
+WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, wishlist.ID, wishlist.UserID)
+	if err != nil {
+		return err
+	}
+	wishlist.Shared = false
+	return nil
+}
+
+// AddItem() appends a record to the end of a wishlist.
+func (m WishlistModel) AddItem(wishlistID, edtoyID int64) error {
+	query := `
+INSERT INTO wishlist_items (wishlist_id, edtoy_id, position)
+SELECT $1, $2, coalesce(max(position), 0) + 1
+FROM wishlist_items
+WHERE wishlist_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, wishlistID, edtoyID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "wishlist_items_pkey"`:
+			return ErrDuplicateWishlistItem
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m WishlistModel) RemoveItem(wishlistID, edtoyID int64) error {
+	query := `
+DELETE FROM wishlist_items
+WHERE wishlist_id = $1 AND edtoy_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, wishlistID, edtoyID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Reorder() sets the position of each item to its place in edtoyIDs, so the first ID
+// given comes first in the list.
+func (m WishlistModel) Reorder(wishlistID int64, edtoyIDs []int64) error {
+	query := `
+UPDATE wishlist_items
+SET position = ordered.position
+FROM unnest($2::bigint[]) WITH ORDINALITY AS ordered(edtoy_id, position)
+WHERE wishlist_items.wishlist_id = $1 AND wishlist_items.edtoy_id = ordered.edtoy_id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, wishlistID, pq.Array(edtoyIDs))
+	return err
+}
@@ -0,0 +1,84 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	// Register the decoders for the formats we accept uploads in.
+	_ "image/gif"
+	_ "image/png"
+)
+
+// MaxPixels is the largest image, by width times height, that Thumbnail will decode.
+// Image formats compress well enough that a small upload can declare dimensions which
+// would take gigabytes of memory to decode.
+const MaxPixels = 40_000_000
+
+// ErrTooLarge is returned by Thumbnail for an image with more than MaxPixels pixels.
+var ErrTooLarge = errors.New("image dimensions are too large")
+
+// Thumbnail decodes an image and returns a JPEG copy scaled down to fit within a
+// size x size box, along with the dimensions of the original. Images that are already
+// small enough are re-encoded at their original size.
+func Thumbnail(src []byte, size int) (thumb []byte, width, height int, err error) {
+	// Check the dimensions from the header before decoding the pixels.
+	config, _, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, 0, 0, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	bounds := img.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+
+	// Work out the target dimensions, preserving the aspect ratio.
+	dstW, dstH := width, height
+	if dstW > size || dstH > size {
+		if width >= height {
+			dstW, dstH = size, max(1, height*size/width)
+		} else {
+			dstW, dstH = max(1, width*size/height), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	// Each destination pixel is the average of the block of source pixels that it
+	// covers. This is slower than nearest-neighbour sampling but avoids the jagged
+	// edges that it produces when shrinking photos.
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*height/dstH
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/dstH)
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*width/dstW
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/dstW)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), width, height, nil
+}
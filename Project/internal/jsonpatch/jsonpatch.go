@@ -0,0 +1,216 @@
+// Package jsonpatch applies RFC 7396 JSON Merge Patch documents and a subset of RFC 6902
+// JSON Patch operations (test, replace and remove) to JSON documents that have been
+// decoded into interface{} values.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrTestFailed is returned when a test operation doesn't match the document.
+var ErrTestFailed = errors.New("test operation failed")
+
+// Operation is a single JSON Patch operation. Value is kept raw so that a missing
+// value can be told apart from an explicit null.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MergePatch applies a merge patch to target and returns the result. Members of the
+// patch set to null are removed from the target, objects are merged recursively and
+// any other value replaces the target outright. The target may be modified in place.
+func MergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = MergePatch(t[key], value)
+	}
+	return t
+}
+
+// Apply runs the operations against doc in order and returns the result. The whole
+// patch fails if any operation does, in which case the returned error names the
+// offending operation. The document may be modified in place.
+func Apply(doc interface{}, ops []Operation) (interface{}, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = apply(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func apply(doc interface{}, op Operation) (interface{}, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "test", "replace":
+		if op.Value == nil {
+			return nil, errors.New("value must be provided")
+		}
+		err = json.Unmarshal(op.Value, &value)
+		if err != nil {
+			return nil, errors.New("value must be valid JSON")
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unsupported op %q, must be one of test, replace or remove", op.Op)
+	}
+
+	// An empty path refers to the whole document.
+	if len(tokens) == 0 {
+		switch op.Op {
+		case "test":
+			if !reflect.DeepEqual(doc, value) {
+				return nil, ErrTestFailed
+			}
+			return doc, nil
+		case "replace":
+			return value, nil
+		default:
+			return nil, errors.New("the whole document can't be removed")
+		}
+	}
+
+	parent, err := resolve(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		current, ok := container[last]
+		if !ok {
+			return nil, errors.New("path does not exist")
+		}
+		switch op.Op {
+		case "test":
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+		case "replace":
+			container[last] = value
+		case "remove":
+			delete(container, last)
+		}
+		return doc, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(container))
+		if err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "test":
+			if !reflect.DeepEqual(container[index], value) {
+				return nil, ErrTestFailed
+			}
+		case "replace":
+			container[index] = value
+		case "remove":
+			// Removing from an array changes its length, so the parent has to be
+			// updated to point at the new slice.
+			shorter := append(container[:index:index], container[index+1:]...)
+			return replaceAt(doc, tokens[:len(tokens)-1], shorter)
+		}
+		return doc, nil
+	default:
+		return nil, errors.New("path does not exist")
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.New("path must be empty or start with /")
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// resolve walks the document along the tokens and returns the value found there.
+func resolve(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, errors.New("path does not exist")
+			}
+			doc = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			doc = container[index]
+		default:
+			return nil, errors.New("path does not exist")
+		}
+	}
+	return doc, nil
+}
+
+// replaceAt swaps the value at the location given by tokens for value.
+func replaceAt(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := resolve(doc, tokens[:len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(container))
+		if err != nil {
+			return nil, err
+		}
+		container[index] = value
+	}
+	return doc, nil
+}
+
+// arrayIndex parses an array reference token. RFC 6901 only allows plain decimal
+// indexes without leading zeros.
+func arrayIndex(token string, length int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%q is not a valid array index", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index >= length {
+		return 0, errors.New("array index is out of range")
+	}
+	return index, nil
+}
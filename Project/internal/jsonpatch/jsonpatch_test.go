@@ -0,0 +1,196 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decoding %s: %v", s, err)
+	}
+	return v
+}
+
+// The examples from RFC 7396 Appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target+" + "+tt.patch, func(t *testing.T) {
+			got := MergePatch(decode(t, tt.target), decode(t, tt.patch))
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("MergePatch = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		// Examples from RFC 6902 Appendix A, for the operations we support.
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "A.8 testing a value: success",
+			doc:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:    "A.9 testing a value: error",
+			doc:     `{"baz":"qux"}`,
+			patch:   `[{"op":"test","path":"/baz","value":"bar"}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:  "A.14 ~ escape ordering",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":10}]`,
+			want:  `{"/":9,"~1":10}`,
+		},
+		{
+			name:    "A.15 comparing strings and numbers",
+			doc:     `{"/":9,"~1":10}`,
+			patch:   `[{"op":"test","path":"/~01","value":"10"}]`,
+			wantErr: ErrTestFailed,
+		},
+		{
+			name:  "~1 escapes a slash",
+			doc:   `{"a/b":1}`,
+			patch: `[{"op":"replace","path":"/a~1b","value":2}]`,
+			want:  `{"a/b":2}`,
+		},
+		{
+			name:  "~0 escapes a tilde",
+			doc:   `{"m~n":1}`,
+			patch: `[{"op":"remove","path":"/m~0n"}]`,
+			want:  `{}`,
+		},
+		{
+			name:  "removing a nested array element",
+			doc:   `{"a":{"b":[1,2,3]}}`,
+			patch: `[{"op":"remove","path":"/a/b/0"}]`,
+			want:  `{"a":{"b":[2,3]}}`,
+		},
+		{
+			name:  "removing the last array element",
+			doc:   `["x"]`,
+			patch: `[{"op":"remove","path":"/0"}]`,
+			want:  `[]`,
+		},
+		{
+			name:  "replacing the whole document",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"","value":[1]}]`,
+			want:  `[1]`,
+		},
+		{
+			name:  "replacing with null",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"/a","value":null}]`,
+			want:  `{"a":null}`,
+		},
+		{
+			name:    "a failed test stops later operations",
+			doc:     `{"a":1}`,
+			patch:   `[{"op":"test","path":"/a","value":2},{"op":"remove","path":"/a"}]`,
+			wantErr: ErrTestFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []Operation
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Apply(decode(t, tt.doc), ops)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Apply error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply error = %v", err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Apply = %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+	}{
+		{"unsupported op", `{}`, `[{"op":"add","path":"/a","value":1}]`},
+		{"missing value", `{"a":1}`, `[{"op":"replace","path":"/a"}]`},
+		{"path without leading slash", `{"a":1}`, `[{"op":"remove","path":"a"}]`},
+		{"missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`},
+		{"missing parent", `{"a":1}`, `[{"op":"replace","path":"/b/c","value":1}]`},
+		{"array index out of range", `[1,2]`, `[{"op":"remove","path":"/2"}]`},
+		{"array index with a leading zero", `[1,2]`, `[{"op":"remove","path":"/01"}]`},
+		{"end of array marker", `[1,2]`, `[{"op":"remove","path":"/-"}]`},
+		{"path through a scalar", `{"a":1}`, `[{"op":"remove","path":"/a/b"}]`},
+		{"removing the whole document", `{"a":1}`, `[{"op":"remove","path":""}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []Operation
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Apply(decode(t, tt.doc), ops)
+			if err == nil || errors.Is(err, ErrTestFailed) {
+				t.Errorf("Apply error = %v, want a patch error", err)
+			}
+		})
+	}
+}
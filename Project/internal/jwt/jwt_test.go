@@ -0,0 +1,179 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	oldKey   = []byte("0123456789abcdef0123456789abcdef")
+	newKey   = []byte("fedcba9876543210fedcba9876543210")
+	otherKey = []byte("an entirely unrelated 32 byte key")
+)
+
+func newTestKeyset(t *testing.T, current string, keys map[string][]byte) *Keyset {
+	t.Helper()
+	k, err := NewKeyset(current, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	claims := Claims{
+		Subject:     "42",
+		Session:     7,
+		Name:        "Alice",
+		Activated:   true,
+		Permissions: []string{"edtoys:read"},
+		IssuedAt:    now.Unix(),
+		Expiry:      now.Add(15 * time.Minute).Unix(),
+	}
+	keys := newTestKeyset(t, "k1", map[string][]byte{"k1": oldKey})
+	token, err := keys.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !LooksLikeToken(token) {
+		t.Errorf("LooksLikeToken(%q) = false", token)
+	}
+	got, err := keys.Verify(token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, claims) {
+		t.Errorf("Verify = %+v, want %+v", *got, claims)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	expiry := now.Add(time.Minute)
+	claims := Claims{Subject: "42", IssuedAt: now.Unix(), Expiry: expiry.Unix()}
+
+	oldKeys := newTestKeyset(t, "k1", map[string][]byte{"k1": oldKey})
+	rotated := newTestKeyset(t, "k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	newOnly := newTestKeyset(t, "k2", map[string][]byte{"k2": newKey})
+	forged := newTestKeyset(t, "k1", map[string][]byte{"k1": otherKey})
+
+	sign := func(k *Keyset, c Claims) string {
+		token, err := k.Sign(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	token := sign(oldKeys, claims)
+	parts := strings.Split(token, ".")
+	admin := sign(oldKeys, Claims{Subject: "1", IssuedAt: now.Unix(), Expiry: expiry.Unix()})
+	adminPayload := strings.Split(admin, ".")[1]
+	forgedSignature := strings.Split(sign(forged, claims), ".")[2]
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	noneHeader := encode(`{"alg":"none","typ":"JWT","kid":"k1"}`)
+	hs512Header := encode(`{"alg":"HS512","typ":"JWT","kid":"k1"}`)
+
+	tests := []struct {
+		name    string
+		keys    *Keyset
+		token   string
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", oldKeys, token, now, nil},
+		{"one second before expiry", oldKeys, token, expiry.Add(-time.Second), nil},
+		{"at expiry", oldKeys, token, expiry, ErrExpiredToken},
+		{"after expiry", oldKeys, token, expiry.Add(time.Hour), ErrExpiredToken},
+		{"signed with the old key after rotation", rotated, token, now, nil},
+		{"signed with a key that has been dropped", newOnly, token, now, ErrInvalidToken},
+		{"signed with the new key", rotated, sign(rotated, claims), now, nil},
+		{"tampered payload", oldKeys, parts[0] + "." + adminPayload + "." + parts[2], now, ErrInvalidToken},
+		{"signature from another key", oldKeys, parts[0] + "." + parts[1] + "." + forgedSignature, now, ErrInvalidToken},
+		{"empty signature", oldKeys, parts[0] + "." + parts[1] + ".", now, ErrInvalidToken},
+		{"alg none", oldKeys, noneHeader + "." + parts[1] + ".", now, ErrInvalidToken},
+		{"alg none with the original signature", oldKeys, noneHeader + "." + parts[1] + "." + parts[2], now, ErrInvalidToken},
+		{"other algorithm", oldKeys, hs512Header + "." + parts[1] + "." + parts[2], now, ErrInvalidToken},
+		{"unknown kid", oldKeys, sign(newOnly, claims), now, ErrInvalidToken},
+		{"too few segments", oldKeys, parts[0] + "." + parts[1], now, ErrInvalidToken},
+		{"malformed header", oldKeys, "!!!." + parts[1] + "." + parts[2], now, ErrInvalidToken},
+		{"opaque token", oldKeys, "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU", now, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.keys.Verify(tt.token, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewKeyset(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		keys    map[string][]byte
+		wantErr bool
+	}{
+		{"valid", "k1", map[string][]byte{"k1": oldKey}, false},
+		{"missing current key", "k2", map[string][]byte{"k1": oldKey}, true},
+		{"short key", "k1", map[string][]byte{"k1": []byte("too short")}, true},
+		{"short old key", "k1", map[string][]byte{"k1": oldKey, "k0": []byte("too short")}, true},
+		{"empty key ID", "k1", map[string][]byte{"k1": oldKey, "": newKey}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyset(tt.current, tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKeyset error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewKeysetCopiesKeys(t *testing.T) {
+	keys := map[string][]byte{"k1": oldKey}
+	keyset := newTestKeyset(t, "k1", keys)
+	token, err := keyset.Sign(Claims{Subject: "42", Expiry: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(keys, "k1")
+	if _, err := keyset.Verify(token, time.Now()); err != nil {
+		t.Errorf("Verify after changing the caller's map: %v", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	std := base64.StdEncoding.EncodeToString(oldKey)
+	url := base64.RawURLEncoding.EncodeToString(newKey)
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string][]byte
+		wantErr bool
+	}{
+		{"single key", "k1:" + std, map[string][]byte{"k1": oldKey}, false},
+		{"several keys with spaces", " k1:" + std + " , k2:" + url + ",", map[string][]byte{"k1": oldKey, "k2": newKey}, false},
+		{"empty", "", map[string][]byte{}, false},
+		{"missing separator", "k1" + std, nil, true},
+		{"duplicate key ID", "k1:" + std + ",k1:" + url, nil, true},
+		{"invalid base64", "k1:not*base64", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKeys(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeys error = %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseKeys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package totp implements RFC 6238 time-based one-time passwords, using the defaults
+// that authenticator apps expect: HMAC-SHA1, 6 digits and a 30 second time step.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	// Digits is the length of a code.
+	Digits = 6
+	// Period is how long each code is valid for.
+	Period = 30 * time.Second
+	// SecretLength is the size of a generated secret, matching the SHA-1 output as
+	// recommended by RFC 4226.
+	SecretLength = 20
+)
+
+// GenerateSecret returns a new random secret.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, SecretLength)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeSecret returns the secret in the unpadded base32 form that users type into
+// authenticator apps.
+func EncodeSecret(secret []byte) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+}
+
+// URI returns the otpauth:// URI for the secret, which authenticator apps can import
+// from a QR code.
+func URI(issuer, account string, secret []byte) string {
+	params := url.Values{}
+	params.Set("secret", EncodeSecret(secret))
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period.Seconds())))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// Step returns the time step that t falls in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the code for the given time step (the RFC 4226 HOTP value with the step
+// as its counter).
+func Code(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	// Dynamic truncation: the low nibble of the last byte picks the four bytes to use.
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1_000_000)
+}
+
+// Match looks for the code among the time steps within skew steps either side of now,
+// to allow for clock drift, and returns the step it matched. Steps at or before after
+// are skipped, so that a code which has already been used can't be replayed.
+func Match(secret []byte, code string, now time.Time, skew int, after int64) (int64, bool) {
+	current := Step(now)
+	for step := current - int64(skew); step <= current+int64(skew); step++ {
+		if step <= after {
+			continue
+		}
+		if hmac.Equal([]byte(Code(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
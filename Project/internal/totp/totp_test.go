@@ -0,0 +1,94 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed used by the test vectors in RFC 6238 Appendix B.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	// RFC 6238 Appendix B gives 8 digit codes; ours are their last 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		want := tt.want[len(tt.want)-Digits:]
+		got := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if got != want {
+			t.Errorf("Code at %d = %q, want %q", tt.unix, got, want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	tests := []struct {
+		name     string
+		code     string
+		after    int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", Code(rfcSecret, current), 0, current, true},
+		{"previous step", Code(rfcSecret, current-1), 0, current - 1, true},
+		{"next step", Code(rfcSecret, current+1), 0, current + 1, true},
+		{"outside the skew", Code(rfcSecret, current-2), 0, 0, false},
+		{"wrong code", "000000", 0, 0, false},
+		{"empty code", "", 0, 0, false},
+		{"replayed", Code(rfcSecret, current), current, 0, false},
+		{"older than the last used", Code(rfcSecret, current-1), current - 1, 0, false},
+		{"newer than the last used", Code(rfcSecret, current), current - 1, current, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Match(rfcSecret, tt.code, now, 1, tt.after)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Match = (%d, %t), want (%d, %t)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Greenlight", "alice@example.com", rfcSecret)
+	for _, want := range []string{
+		"otpauth://totp/Greenlight:alice@example.com?",
+		"secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"issuer=Greenlight",
+		"digits=6",
+		"period=30",
+	} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("URI = %q, want it to contain %q", uri, want)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != SecretLength {
+		t.Errorf("len(secret) = %d, want %d", len(a), SecretLength)
+	}
+	if string(a) == string(b) {
+		t.Error("two generated secrets are identical")
+	}
+}
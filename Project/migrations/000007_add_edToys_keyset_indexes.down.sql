@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS edToys_title_id_idx;
+DROP INDEX IF EXISTS edToys_year_id_idx;
+DROP INDEX IF EXISTS edToys_runtime_id_idx;
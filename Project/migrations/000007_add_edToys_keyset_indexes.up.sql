@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS edToys_title_id_idx ON edToys (title, id);
+CREATE INDEX IF NOT EXISTS edToys_year_id_idx ON edToys (year, id);
+CREATE INDEX IF NOT EXISTS edToys_runtime_id_idx ON edToys (runtime, id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS edToys_skill_focus_idx;
+DROP INDEX IF EXISTS edToys_created_at_idx;
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS edToys_skill_focus_idx ON edToys USING GIN (skill_focus);
+CREATE INDEX IF NOT EXISTS edToys_created_at_idx ON edToys (created_at);
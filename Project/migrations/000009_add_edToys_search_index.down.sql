@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS edToys_search_idx;
+DROP FUNCTION IF EXISTS edtoys_search_vector(text, text[], text[]);
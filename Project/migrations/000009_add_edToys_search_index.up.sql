@@ -0,0 +1,8 @@
+CREATE OR REPLACE FUNCTION edtoys_search_vector(title text, skill_focus text[], genres text[])
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+           setweight(to_tsvector('english', coalesce(array_to_string(skill_focus, ' '), '')), 'B') ||
+           setweight(to_tsvector('english', coalesce(array_to_string(genres, ' '), '')), 'C')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS edToys_search_idx ON edToys USING GIN (edtoys_search_vector(title, skill_focus, genres));
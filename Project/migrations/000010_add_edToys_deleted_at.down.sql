@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS edToys_deleted_at_idx;
+ALTER TABLE edToys DROP COLUMN IF EXISTS deleted_at;
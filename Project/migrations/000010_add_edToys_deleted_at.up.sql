@@ -0,0 +1,2 @@
+ALTER TABLE edToys ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+CREATE INDEX IF NOT EXISTS edToys_deleted_at_idx ON edToys (deleted_at) WHERE deleted_at IS NOT NULL;
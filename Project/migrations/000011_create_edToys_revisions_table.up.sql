@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS edtoys_revisions (
+    id bigserial PRIMARY KEY,
+    edtoy_id bigint NOT NULL REFERENCES edToys ON DELETE CASCADE,
+    version integer NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    snapshot jsonb NOT NULL,
+    changes jsonb NOT NULL,
+    UNIQUE (edtoy_id, version)
+);
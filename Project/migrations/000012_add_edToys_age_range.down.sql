@@ -0,0 +1,10 @@
+ALTER TABLE edToys ADD COLUMN target_age_text VARCHAR(20);
+UPDATE edToys SET target_age_text = left(target_age, 20);
+ALTER TABLE edToys DROP COLUMN target_age;
+ALTER TABLE edToys RENAME COLUMN target_age_text TO target_age;
+ALTER TABLE edToys ALTER COLUMN target_age SET NOT NULL;
+
+DROP INDEX IF EXISTS edToys_age_idx;
+ALTER TABLE edToys DROP CONSTRAINT IF EXISTS edToys_age_range_check;
+ALTER TABLE edToys DROP COLUMN IF EXISTS max_age_months;
+ALTER TABLE edToys DROP COLUMN IF EXISTS min_age_months;
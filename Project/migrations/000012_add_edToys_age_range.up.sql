@@ -0,0 +1,72 @@
+-- Parse the legacy free-form target_age strings ("3+", "4-6 years", "18-36 months", ...)
+-- into an age range in months. This mirrors data.ParseTargetAge().
+CREATE OR REPLACE FUNCTION parse_target_age(value text, OUT min_months integer, OUT max_months integer) AS $$
+DECLARE
+    parts text[];
+BEGIN
+    parts := regexp_match(lower(trim(value)),
+        '^(\d{1,3})\s*(?:(?:-|–|to)\s*(\d{1,3}))?\s*(\+)?\s*(years?|yrs?|y|months?|mos?|m)?\s*(\+)?$');
+    -- Anything that can't be parsed is treated as suitable for all ages.
+    IF parts IS NULL THEN
+        min_months := 0;
+        max_months := NULL;
+        RETURN;
+    END IF;
+    -- So is a range that runs backwards, such as "6-4 years".
+    IF parts[2]::integer < parts[1]::integer THEN
+        min_months := 0;
+        max_months := NULL;
+        RETURN;
+    END IF;
+    IF coalesce(parts[4], '') LIKE 'm%' THEN
+        min_months := parts[1]::integer;
+        max_months := coalesce(parts[2], parts[1])::integer;
+    ELSE
+        min_months := parts[1]::integer * 12;
+        max_months := coalesce(parts[2], parts[1])::integer * 12 + 11;
+    END IF;
+    -- Ages past the oldest the API accepts (maxAgeMonths) are brought down to it.
+    min_months := least(min_months, 1199);
+    max_months := least(max_months, 1199);
+    IF parts[2] IS NULL AND (parts[3] IS NOT NULL OR parts[5] IS NOT NULL) THEN
+        max_months := NULL;
+    END IF;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+ALTER TABLE edToys ADD COLUMN IF NOT EXISTS min_age_months integer NOT NULL DEFAULT 0;
+ALTER TABLE edToys ADD COLUMN IF NOT EXISTS max_age_months integer;
+
+UPDATE edToys
+SET (min_age_months, max_age_months) = (SELECT min_months, max_months FROM parse_target_age(target_age));
+
+UPDATE edtoys_revisions
+SET snapshot = snapshot || (
+    SELECT jsonb_build_object('min_age_months', min_months, 'max_age_months', max_months)
+    FROM parse_target_age(snapshot->>'target_age'))
+WHERE NOT snapshot ? 'min_age_months';
+
+-- target_age lives on as a read-only rendering of the range, so existing clients keep
+-- receiving the field.
+ALTER TABLE edToys DROP COLUMN target_age;
+ALTER TABLE edToys ADD COLUMN target_age text GENERATED ALWAYS AS (
+    CASE
+        WHEN min_age_months % 12 = 0 AND max_age_months IS NULL
+            THEN (min_age_months / 12)::text || '+ years'
+        WHEN max_age_months IS NULL
+            THEN min_age_months::text || '+ months'
+        WHEN min_age_months % 12 = 0 AND max_age_months - min_age_months = 11
+            THEN (min_age_months / 12)::text || ' years'
+        WHEN min_age_months % 12 = 0 AND max_age_months % 12 = 11
+            THEN (min_age_months / 12)::text || '-' || (max_age_months / 12)::text || ' years'
+        WHEN min_age_months = max_age_months
+            THEN min_age_months::text || ' months'
+        ELSE min_age_months::text || '-' || max_age_months::text || ' months'
+    END
+) STORED;
+
+ALTER TABLE edToys ADD CONSTRAINT edToys_age_range_check
+    CHECK (min_age_months >= 0 AND (max_age_months IS NULL OR max_age_months >= min_age_months));
+CREATE INDEX IF NOT EXISTS edToys_age_idx ON edToys (min_age_months, max_age_months);
+
+DROP FUNCTION parse_target_age(text);
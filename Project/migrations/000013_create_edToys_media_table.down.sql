@@ -0,0 +1 @@
+DROP TABLE IF EXISTS edtoys_media;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS edtoys_media (
+    id bigserial PRIMARY KEY,
+    edtoy_id bigint NOT NULL REFERENCES edToys ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    content_type text NOT NULL,
+    size_bytes bigint NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    key text NOT NULL UNIQUE,
+    thumbnail_key text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS edtoys_media_edtoy_id_idx ON edtoys_media (edtoy_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS edToys_average_rating_idx;
+ALTER TABLE edToys DROP COLUMN IF EXISTS review_count;
+ALTER TABLE edToys DROP COLUMN IF EXISTS average_rating;
+DROP TABLE IF EXISTS reviews;
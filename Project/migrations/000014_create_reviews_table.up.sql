@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS reviews (
+    id bigserial PRIMARY KEY,
+    edtoy_id bigint NOT NULL REFERENCES edToys ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    rating smallint NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title text NOT NULL DEFAULT '',
+    body text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (edtoy_id, user_id)
+);
+
+ALTER TABLE edToys ADD COLUMN IF NOT EXISTS average_rating numeric(3, 2) NOT NULL DEFAULT 0;
+ALTER TABLE edToys ADD COLUMN IF NOT EXISTS review_count integer NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS edToys_average_rating_idx ON edToys (average_rating, id);
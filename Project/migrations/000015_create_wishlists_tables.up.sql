@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS wishlists (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    share_hash bytea UNIQUE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS wishlists_user_id_idx ON wishlists (user_id);
+
+CREATE TABLE IF NOT EXISTS wishlist_items (
+    wishlist_id bigint NOT NULL REFERENCES wishlists ON DELETE CASCADE,
+    edtoy_id bigint NOT NULL REFERENCES edToys ON DELETE CASCADE,
+    position integer NOT NULL,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (wishlist_id, edtoy_id)
+);
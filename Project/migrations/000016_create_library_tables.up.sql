@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS edtoys_copies (
+    id bigserial PRIMARY KEY,
+    edtoy_id bigint NOT NULL REFERENCES edToys ON DELETE CASCADE,
+    barcode text NOT NULL UNIQUE,
+    notes text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    retired_at timestamp(0) with time zone
+);
+CREATE INDEX IF NOT EXISTS edtoys_copies_edtoy_id_idx ON edtoys_copies (edtoy_id) WHERE retired_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS loans (
+    id bigserial PRIMARY KEY,
+    copy_id bigint NOT NULL REFERENCES edtoys_copies ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    checked_out_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    due_at timestamp(0) with time zone NOT NULL,
+    returned_at timestamp(0) with time zone,
+    CHECK (due_at > checked_out_at)
+);
+-- A copy can only be out on one loan at a time. Checkouts are serialised in the
+-- application, but this keeps the data honest regardless.
+CREATE UNIQUE INDEX IF NOT EXISTS loans_active_copy_idx ON loans (copy_id) WHERE returned_at IS NULL;
+CREATE INDEX IF NOT EXISTS loans_user_id_idx ON loans (user_id);
+CREATE INDEX IF NOT EXISTS loans_due_at_idx ON loans (due_at) WHERE returned_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS reservations (
+    id bigserial PRIMARY KEY,
+    edtoy_id bigint NOT NULL REFERENCES edToys ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (edtoy_id, user_id)
+);
@@ -0,0 +1,14 @@
+-- Put back the original values of records whose values haven't been edited since they
+-- were rewritten to slugs. Records edited since keep what they were given.
+UPDATE edToys SET
+    genres = CASE WHEN edToys.genres = taxonomy_slugs(o.genres) THEN o.genres ELSE edToys.genres END,
+    skill_focus = CASE WHEN edToys.skill_focus = taxonomy_slugs(o.skill_focus) THEN o.skill_focus ELSE edToys.skill_focus END
+FROM taxonomy_original_values o
+WHERE o.edtoy_id = edToys.id;
+
+DROP TABLE IF EXISTS taxonomy_original_values;
+DELETE FROM permissions WHERE code = 'taxonomy:write';
+DROP TABLE IF EXISTS taxonomy_synonyms;
+DROP TABLE IF EXISTS taxonomy_terms;
+DROP FUNCTION IF EXISTS taxonomy_slugs(text[]);
+DROP FUNCTION IF EXISTS taxonomy_slug(text);
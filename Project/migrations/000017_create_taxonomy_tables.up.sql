@@ -0,0 +1,87 @@
+-- Turns free text into a slug: lower case, with runs of spaces and punctuation collapsed
+-- to single hyphens. Letters and digits from any script are kept, so Kazakh and Russian
+-- values stay distinct. Values with nothing usable get a slug made from their hash
+-- rather than a shared fallback, so unrelated values never end up as one term.
+CREATE OR REPLACE FUNCTION taxonomy_slug(value text) RETURNS text AS $$
+    SELECT coalesce(
+        nullif(trim(BOTH '-' FROM regexp_replace(lower(value), '[[:space:][:punct:]]+', '-', 'g')), ''),
+        'term-' || left(md5(value), 8))
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Rewrites a record's values to slugs, dropping any duplicates this creates while
+-- keeping the original order.
+CREATE OR REPLACE FUNCTION taxonomy_slugs(vals text[]) RETURNS text[] AS $$
+    SELECT ARRAY(
+        SELECT taxonomy_slug(value)
+        FROM unnest(vals) WITH ORDINALITY AS v(value, n)
+        GROUP BY taxonomy_slug(value)
+        ORDER BY min(n))
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE TABLE IF NOT EXISTS taxonomy_terms (
+    id bigserial PRIMARY KEY,
+    kind text NOT NULL CHECK (kind IN ('genre', 'skill')),
+    slug text NOT NULL CHECK (slug ~ '^[^[:space:][:punct:]]+(-[^[:space:][:punct:]]+)*$'),
+    name text NOT NULL,
+    parent_id bigint REFERENCES taxonomy_terms ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (kind, slug)
+);
+CREATE INDEX IF NOT EXISTS taxonomy_terms_parent_id_idx ON taxonomy_terms (parent_id);
+
+-- Synonyms are stored in lower case and are unique within a kind, so each one resolves
+-- to exactly one term.
+CREATE TABLE IF NOT EXISTS taxonomy_synonyms (
+    kind text NOT NULL,
+    synonym text NOT NULL,
+    term_id bigint NOT NULL REFERENCES taxonomy_terms ON DELETE CASCADE,
+    PRIMARY KEY (kind, synonym)
+);
+CREATE INDEX IF NOT EXISTS taxonomy_synonyms_term_id_idx ON taxonomy_synonyms (term_id);
+
+-- Seed the taxonomy from the values already in use. Values that only differ in case
+-- or punctuation ("STEM", "stem") collapse into one term, named after the first
+-- spelling alphabetically, and every original spelling is kept as a synonym.
+CREATE TEMPORARY TABLE existing_terms AS
+SELECT 'genre' AS kind, value FROM edToys, unnest(genres) AS value
+UNION
+SELECT 'skill' AS kind, value FROM edToys, unnest(skill_focus) AS value;
+
+INSERT INTO taxonomy_terms (kind, slug, name)
+SELECT DISTINCT ON (kind, taxonomy_slug(value)) kind, taxonomy_slug(value), value
+FROM existing_terms
+ORDER BY kind, taxonomy_slug(value), value;
+
+INSERT INTO taxonomy_synonyms (kind, synonym, term_id)
+SELECT DISTINCT existing_terms.kind, lower(existing_terms.value), taxonomy_terms.id
+FROM existing_terms
+INNER JOIN taxonomy_terms ON taxonomy_terms.kind = existing_terms.kind
+    AND taxonomy_terms.slug = taxonomy_slug(existing_terms.value)
+WHERE lower(existing_terms.value) <> taxonomy_terms.slug
+ON CONFLICT DO NOTHING;
+
+DROP TABLE existing_terms;
+
+-- Keep the values of every record that's about to be rewritten, so that the down
+-- migration can put them back.
+CREATE TABLE IF NOT EXISTS taxonomy_original_values (
+    edtoy_id bigint PRIMARY KEY REFERENCES edtoys ON DELETE CASCADE,
+    genres text[] NOT NULL,
+    skill_focus text[] NOT NULL
+);
+
+INSERT INTO taxonomy_original_values (edtoy_id, genres, skill_focus)
+SELECT id, genres, skill_focus
+FROM edToys
+WHERE genres <> taxonomy_slugs(genres) OR skill_focus <> taxonomy_slugs(skill_focus);
+
+-- Rewrite the records to use slugs.
+UPDATE edToys SET
+    genres = taxonomy_slugs(genres),
+    skill_focus = taxonomy_slugs(skill_focus)
+WHERE id IN (SELECT edtoy_id FROM taxonomy_original_values);
+
+INSERT INTO permissions (code)
+SELECT 'taxonomy:write'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'taxonomy:write');
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS edtoys_translations;
+DROP FUNCTION IF EXISTS locale_search_config(text);
+
+DROP INDEX IF EXISTS edToys_search_idx;
+DROP FUNCTION IF EXISTS edtoys_search_vector(text, text, text[], text[]);
+
+CREATE OR REPLACE FUNCTION edtoys_search_vector(title text, skill_focus text[], genres text[])
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+           setweight(to_tsvector('english', coalesce(array_to_string(skill_focus, ' '), '')), 'B') ||
+           setweight(to_tsvector('english', coalesce(array_to_string(genres, ' '), '')), 'C')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS edToys_search_idx ON edToys USING GIN (edtoys_search_vector(title, skill_focus, genres));
+
+ALTER TABLE edToys DROP COLUMN IF EXISTS description;
@@ -0,0 +1,42 @@
+ALTER TABLE edToys ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '';
+
+-- The base record is written in English. Its search document now takes in the
+-- description too, at the lowest weight, so the index is rebuilt on the new function.
+DROP INDEX IF EXISTS edToys_search_idx;
+DROP FUNCTION IF EXISTS edtoys_search_vector(text, text[], text[]);
+
+CREATE OR REPLACE FUNCTION edtoys_search_vector(title text, description text, skill_focus text[], genres text[])
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+           setweight(to_tsvector('english', coalesce(array_to_string(skill_focus, ' '), '')), 'B') ||
+           setweight(to_tsvector('english', coalesce(array_to_string(genres, ' '), '')), 'C') ||
+           setweight(to_tsvector('english', coalesce(description, '')), 'D')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS edToys_search_idx ON edToys USING GIN (edtoys_search_vector(title, description, skill_focus, genres));
+
+-- Maps a supported locale to the text search configuration its translations are
+-- indexed and searched with. Postgres has no Kazakh stemmer, so kk uses 'simple'.
+CREATE OR REPLACE FUNCTION locale_search_config(locale text) RETURNS regconfig AS $$
+    SELECT CASE locale
+        WHEN 'en' THEN 'english'::regconfig
+        WHEN 'ru' THEN 'russian'::regconfig
+        ELSE 'simple'::regconfig
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE TABLE IF NOT EXISTS edtoys_translations (
+    edtoy_id bigint NOT NULL REFERENCES edToys ON DELETE CASCADE,
+    locale text NOT NULL CHECK (locale IN ('ru', 'kk')),
+    title text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector(locale_search_config(locale), title), 'A') ||
+        setweight(to_tsvector(locale_search_config(locale), description), 'D')
+    ) STORED,
+    PRIMARY KEY (edtoy_id, locale)
+);
+CREATE INDEX IF NOT EXISTS edtoys_translations_search_idx ON edtoys_translations USING GIN (search_vector);
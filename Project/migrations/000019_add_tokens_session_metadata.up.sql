@@ -0,0 +1,7 @@
+-- Tokens are keyed by their hash, which is never shown to clients, so sessions get a
+-- separate ID that they can be referred to by.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS id bigserial UNIQUE;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS ip text NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS user_agent text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens (user_id, scope);
@@ -0,0 +1,6 @@
+DELETE FROM tokens WHERE scope = 'refresh';
+ALTER TABLE tokens DROP CONSTRAINT IF EXISTS tokens_family_id_check;
+DROP INDEX IF EXISTS tokens_family_id_idx;
+ALTER TABLE tokens DROP COLUMN IF EXISTS used_at;
+ALTER TABLE tokens DROP COLUMN IF EXISTS family_id;
+DROP TABLE IF EXISTS token_families;
@@ -0,0 +1,29 @@
+-- A token family is one login session: the access (authentication) tokens and the chain
+-- of rotating refresh tokens issued from a single sign-in. Deleting the family revokes
+-- every token in it.
+CREATE TABLE IF NOT EXISTS token_families (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ip text NOT NULL DEFAULT '',
+    user_agent text NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS token_families_user_id_idx ON token_families (user_id);
+
+-- Refresh tokens are kept after use, stamped with used_at, so that presenting one a
+-- second time can be spotted.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family_id bigint REFERENCES token_families ON DELETE CASCADE;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS used_at timestamp(0) with time zone;
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
+
+-- Each existing authentication token becomes a session of its own, reusing its ID.
+INSERT INTO token_families (id, user_id, created_at, last_used_at, ip, user_agent)
+SELECT id, user_id, created_at, created_at, ip, user_agent
+FROM tokens
+WHERE scope = 'authentication';
+UPDATE tokens SET family_id = id WHERE scope = 'authentication';
+SELECT setval(pg_get_serial_sequence('token_families', 'id'), coalesce((SELECT max(id) FROM token_families), 0) + 1, false);
+
+ALTER TABLE tokens ADD CONSTRAINT tokens_family_id_check
+    CHECK (family_id IS NOT NULL OR scope NOT IN ('authentication', 'refresh'));
@@ -0,0 +1,6 @@
+DELETE FROM tokens WHERE scope = 'mfa';
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_required;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_enabled;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,19 @@
+-- The TOTP secret has to be kept readable, unlike tokens and passwords, since codes are
+-- computed from it. It's set when enrollment starts and totp_enabled is only switched on
+-- once the user has confirmed a code from it. totp_last_step is the time step of the
+-- last code accepted, so that a code can't be used twice.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret bytea;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled boolean NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step bigint NOT NULL DEFAULT 0;
+-- mfa_required is set by an administrator, and stops the user doing anything beyond
+-- setting up two-factor authentication until they have.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_required boolean NOT NULL DEFAULT false;
+
+-- Recovery codes are stored as SHA-256 hashes, like tokens, and each works once.
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    hash bytea PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    used_at timestamp(0) with time zone
+);
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);